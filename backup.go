@@ -0,0 +1,237 @@
+package ovoclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	recordKV      = "kv"
+	recordCounter = "counter"
+	// maximum size of an archive line
+	maxArchiveLine = 64 * 1024 * 1024
+)
+
+// ErrCounterCAS is returned when a counter is imported with ConflictCAS: OVO has no compare-and-swap of the counters.
+var ErrCounterCAS = errors.New("Compare-and-swap not supported for the counters.")
+
+// Conflict policy used by Import when a key is already stored in the cluster.
+type ConflictPolicy int
+
+const (
+	ConflictOverwrite ConflictPolicy = iota // the archived value replaces the stored value
+	ConflictSkip                            // the stored value is kept
+	ConflictCAS                             // the stored value is replaced with a compare-and-swap, so concurrent updates are not lost; the counters fail with ErrCounterCAS
+)
+
+// A record of a backup archive; the archive is a stream of JSON records, one per line.
+type ArchiveRecord struct {
+	Type  string // kv or counter
+	Key   string
+	Data  []byte `json:",omitempty"` // raw value of a kv record
+	Value int64  `json:",omitempty"` // value of a counter record
+	TTL   int    `json:",omitempty"` // time to live in seconds, zero if the record does not expire or if the server did not report it
+}
+
+// Options of the Export operation.
+type ExportOptions struct {
+	Prefix   string   // export only the keys starting with the prefix
+	Counters []string // counters to export; OVO cannot list the stored counters, so they must be named
+}
+
+// Options of the Import operation.
+type ImportOptions struct {
+	Concurrency int            // number of concurrent writers, 1 if not set
+	TTL         int            // time to live in seconds of the records without their own TTL
+	Conflict    ConflictPolicy // what to do when a key is already stored
+}
+
+// Statistics of an Export or Import operation.
+type BackupStats struct {
+	Keys     int // number of objects exported or imported
+	Counters int // number of counters exported or imported
+	Skipped  int // records skipped because missing (export) or already stored (import)
+	Failed   int // records that could not be imported
+}
+
+// Export every key of the cluster, its raw value and the requested counters into a line-delimited JSON archive.
+// The records keep the remaining time to live reported by the server.
+// Keys removed while the export is running are skipped; a node whose keys cannot be listed or a key whose replicas do not answer
+// stops the export with an error, so that an incomplete archive is never reported as complete.
+func (c *Client) Export(ctx context.Context, w io.Writer, opts ExportOptions) (BackupStats, error) {
+	stats := BackupStats{}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	keys, err := c.allKeys(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("export failed: %v", err)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, opts.Prefix) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		rs, err := c.getRaw(key)
+		if err == ErrKeyNotFound {
+			stats.Skipped++
+			continue
+		} else if err != nil {
+			return stats, fmt.Errorf("export of %s failed: %v", key, err)
+		}
+		if err = enc.Encode(&ArchiveRecord{Type: recordKV, Key: key, Data: kvData(rs), TTL: kvTTL(rs)}); err != nil {
+			return stats, err
+		}
+		stats.Keys++
+	}
+	for _, key := range opts.Counters {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		rs, err := c.getCounter(key)
+		if err != nil {
+			return stats, fmt.Errorf("export of counter %s failed: %v", key, err)
+		}
+		if err = enc.Encode(&ArchiveRecord{Type: recordCounter, Key: key, Value: counterValue(rs), TTL: counterTTL(rs)}); err != nil {
+			return stats, err
+		}
+		stats.Counters++
+	}
+	return stats, bw.Flush()
+}
+
+// Import the records of an archive created by Export.
+// The records are written by opts.Concurrency goroutines; a failed record does not stop the import
+// and the first error is returned together with the statistics.
+func (c *Client) Import(ctx context.Context, r io.Reader, opts ImportOptions) (BackupStats, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	stats := BackupStats{}
+	var firstErr error
+	var mux sync.Mutex
+	records := make(chan *ArchiveRecord)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range records {
+				skipped, err := c.importRecord(rec, opts)
+				mux.Lock()
+				if err != nil {
+					stats.Failed++
+					if firstErr == nil {
+						firstErr = fmt.Errorf("import of %s failed: %v", rec.Key, err)
+					}
+				} else if skipped {
+					stats.Skipped++
+				} else if rec.Type == recordCounter {
+					stats.Counters++
+				} else {
+					stats.Keys++
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+	readErr := readArchive(ctx, r, records)
+	close(records)
+	wg.Wait()
+	if readErr != nil {
+		return stats, readErr
+	}
+	return stats, firstErr
+}
+
+// Read the archive records and send them to the channel.
+func readArchive(ctx context.Context, r io.Reader, records chan<- *ArchiveRecord) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxArchiveLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		rec := &ArchiveRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			return fmt.Errorf("invalid archive record at line %d: %v", line, err)
+		}
+		if rec.Key == "" || (rec.Type != recordKV && rec.Type != recordCounter) {
+			return fmt.Errorf("invalid archive record at line %d", line)
+		}
+		select {
+		case records <- rec:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// Write a record applying the conflict policy; it returns true if the record was skipped.
+func (c *Client) importRecord(rec *ArchiveRecord, opts ImportOptions) (bool, error) {
+	ttl := rec.TTL
+	if ttl == 0 {
+		ttl = opts.TTL
+	}
+	if rec.Type == recordCounter {
+		if opts.Conflict == ConflictCAS {
+			return false, ErrCounterCAS
+		}
+		if opts.Conflict == ConflictSkip {
+			// a missing counter is read as zero
+			if value, err := c.GetCounter(rec.Key); err != nil {
+				return false, err
+			} else if value != 0 {
+				return true, nil
+			}
+		}
+		_, err := c.SetCounter(rec.Key, rec.Value, ttl)
+		return false, written(err)
+	}
+	if opts.Conflict == ConflictOverwrite {
+		return false, written(c.PutRawData(rec.Key, rec.Data, ttl))
+	}
+	stored, err := c.GetRawData(rec.Key)
+	if err == ErrKeyNotFound {
+		return false, written(c.PutRawData(rec.Key, rec.Data, ttl))
+	} else if err != nil {
+		return false, err
+	}
+	if opts.Conflict == ConflictSkip || bytes.Equal(stored, rec.Data) {
+		return true, nil
+	}
+	// the update keeps the TTL of the stored object
+	return false, written(c.updateRawDataIfEqual(rec.Key, stored, rec.Data))
+}
+
+// Ignore the durable replication errors: the record was written.
+func written(err error) error {
+	if IsDurable(err) {
+		return nil
+	}
+	return err
+}
+
+// Parse the name of a conflict policy (overwrite, skip or cas).
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch strings.ToLower(name) {
+	case "overwrite":
+		return ConflictOverwrite, nil
+	case "skip":
+		return ConflictSkip, nil
+	case "cas":
+		return ConflictCAS, nil
+	}
+	return ConflictOverwrite, errors.New("Invalid conflict policy " + name + ".")
+}
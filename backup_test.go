@@ -0,0 +1,109 @@
+package ovoclient
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := NewClientFromConfig(newFakeCluster(t, 2).config())
+	defer src.Close()
+	src.PutRawData("backup1", []byte("raw value"), 0)
+	src.Put("backup2", map[string]int{"a": 1}, 0)
+	src.Put("other", "not exported", 0)
+	src.SetCounter("backupCounter", 42, 0)
+	var archive bytes.Buffer
+	stats, err := src.Export(context.Background(), &archive, ExportOptions{Prefix: "backup", Counters: []string{"backupCounter"}})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if stats.Keys != 2 || stats.Counters != 1 || strings.Count(archive.String(), "\n") != 3 {
+		t.Fatalf("unexpected export %+v:\n%s", stats, archive.String())
+	}
+	dst := NewClientFromConfig(newFakeCluster(t, 3).config())
+	defer dst.Close()
+	dst.PutRawData("backup1", []byte("newer value"), 0)
+	stats, err = dst.Import(context.Background(), bytes.NewReader(archive.Bytes()), ImportOptions{Concurrency: 4, Conflict: ConflictSkip})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Keys != 1 || stats.Skipped != 1 || stats.Counters != 1 {
+		t.Errorf("unexpected import %+v", stats)
+	}
+	if data, _ := dst.GetRawData("backup1"); string(data) != "newer value" {
+		t.Errorf("skip policy overwrote the value: %s", data)
+	}
+	var value map[string]int
+	if err := dst.Get("backup2", &value); err != nil || value["a"] != 1 {
+		t.Errorf("Get returned %v, %v", value, err)
+	}
+	if count, _ := dst.GetCounter("backupCounter"); count != 42 {
+		t.Errorf("counter not imported: %d", count)
+	}
+	// the counters cannot be imported with a compare-and-swap
+	stats, err = dst.Import(context.Background(), bytes.NewReader(archive.Bytes()), ImportOptions{Conflict: ConflictCAS})
+	if err == nil || !strings.Contains(err.Error(), ErrCounterCAS.Error()) || stats.Failed != 1 || stats.Keys != 1 {
+		t.Fatalf("Import returned %+v, %v", stats, err)
+	}
+	if data, _ := dst.GetRawData("backup1"); string(data) != "raw value" {
+		t.Errorf("cas policy did not replace the value: %s", data)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	c := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer c.Close()
+	_, err := c.Import(context.Background(), strings.NewReader("{\"Type\":\"kv\",\"Key\":\"a\"}\nnot json\n"), ImportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestExportImportTTL(t *testing.T) {
+	src := NewClientFromConfig(newFakeCluster(t, 2).config())
+	defer src.Close()
+	src.Put("session", "value", 60)
+	src.Put("permanent", "value", 0)
+	src.SetCounter("visits", 3, 120)
+	var archive bytes.Buffer
+	if _, err := src.Export(context.Background(), &archive, ExportOptions{Counters: []string{"visits"}}); err != nil {
+		t.Fatal(err)
+	}
+	fc := newFakeCluster(t, 1)
+	dst := NewClientFromConfig(fc.config())
+	defer dst.Close()
+	// the records without a time to live get the one of the options
+	if _, err := dst.Import(context.Background(), &archive, ImportOptions{TTL: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	node := fc.nodes[0]
+	if node.ttl("session") != 60 || node.ttl("permanent") != 3600 || node.ttl("#visits") != 120 {
+		t.Errorf("unexpected time to live %d, %d, %d", node.ttl("session"), node.ttl("permanent"), node.ttl("#visits"))
+	}
+}
+
+func TestExportUnavailableSlot(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("lost")
+	twin := fc.node(owner.node.Twins[0])
+	// the key is listed by the third node while its replicas are down
+	for _, fn := range fc.nodes {
+		if fn != owner && fn != twin {
+			fn.store("lost", []byte("value"))
+		}
+	}
+	owner.setDown(true)
+	twin.setDown(true)
+	if _, err := c.GetRawData("lost"); err != ErrNodeUnavailable {
+		t.Errorf("unexpected error %v", err)
+	}
+	// the replicas cannot list their keys either, so the archive would be incomplete
+	stats, err := c.Export(context.Background(), &bytes.Buffer{}, ExportOptions{})
+	if err == nil || !strings.Contains(err.Error(), "not listed") || stats.Skipped != 0 {
+		t.Errorf("Export returned %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,82 @@
+package ovoclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Class of the answer of a node.
+type responseClass int
+
+const (
+	// The node executed the operation.
+	classSuccess responseClass = iota
+	// The node answered for the key, e.g. 404 (key not found) or 403 (value not equal): the twins are not asked.
+	classAuthoritative
+	// The node did not answer or failed (transport errors, 5xx statuses and the FailoverCodes): the operation fails over to the twins.
+	classNodeFailure
+)
+
+// A NodeError is returned when a node answers with a 5xx status or with one of the FailoverCodes.
+type NodeError struct {
+	Node   string
+	Status int
+	Code   string // OVO error code of the answer, if any
+}
+
+func (e *NodeError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("Node %s failed with status %d and code %s.", e.Node, e.Status, e.Code)
+	}
+	return fmt.Sprintf("Node %s failed with status %d.", e.Node, e.Status)
+}
+
+// Get the OVO error code of a response.
+func errorCode(rs *Response) string {
+	answer := struct{ Code string }{}
+	if len(rs.body) == 0 || json.Unmarshal(rs.body, &answer) != nil {
+		return ""
+	}
+	return answer.Code
+}
+
+// Classify the answer of a node.
+func (c *Client) classify(rs *Response, err error) responseClass {
+	if err != nil {
+		return classNodeFailure
+	}
+	if rs.status >= 500 {
+		return classNodeFailure
+	}
+	if rs.status < 300 {
+		return classSuccess
+	}
+	if codes := c.getConfig().FailoverCodes; len(codes) > 0 {
+		code := errorCode(rs)
+		for _, fc := range codes {
+			if code == fc {
+				return classNodeFailure
+			}
+		}
+	}
+	return classAuthoritative
+}
+
+// Wrap an operation so that the node failures are returned as errors and counted by the health tracker.
+// The operations canceled by the caller (e.g. the slower request of a hedged read) are not node failures.
+func (c *Client) classified(op nodeOp) nodeOp {
+	return func(ctx context.Context, s *Session) (*Response, error) {
+		rs, err := op(ctx, s)
+		if c.classify(rs, err) != classNodeFailure {
+			return rs, nil
+		}
+		if err == nil {
+			err = &NodeError{Node: s.Node().Name, Status: rs.status, Code: errorCode(rs)}
+		}
+		if ctx.Err() == nil {
+			c.health.failure(s.Node(), err)
+		}
+		return nil, err
+	}
+}
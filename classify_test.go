@@ -0,0 +1,81 @@
+package ovoclient
+
+import (
+	"testing"
+)
+
+func TestFailoverOnServerError(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("failing")
+	twin := fc.node(owner.node.Twins[0])
+	owner.setStatus(503)
+	if err := c.Put("failing", "value", 0); !IsDurable(err) {
+		t.Fatal(err)
+	}
+	if _, ok := twin.value("failing"); !ok {
+		t.Error("write not sent to the twin")
+	}
+	var value string
+	if err := c.Get("failing", &value); err != nil || value != "value" {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	// the failures are counted by the health tracker
+	for _, nh := range c.Health().Nodes {
+		if nh.Name == owner.node.Name && (nh.Failures < 2 || nh.Alive) {
+			t.Errorf("unexpected health %+v", nh)
+		}
+	}
+}
+
+func TestNoFailoverOnNotFound(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("missing")
+	twin := fc.node(owner.node.Twins[0])
+	twin.store("missing", []byte(`"stale"`))
+	// the primary is authoritative: the stale copy of the twin is not read
+	var value string
+	if err := c.Get("missing", &value); err != ErrKeyNotFound {
+		t.Errorf("Get returned %q, %v", value, err)
+	}
+	for _, nh := range c.Health().Nodes {
+		if nh.Failures != 0 {
+			t.Errorf("unexpected health %+v", nh)
+		}
+	}
+}
+
+func TestFailoverCodes(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.FailoverCodes = []string{"503"}
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("overloaded")
+	twin := fc.node(owner.node.Twins[0])
+	twin.store("overloaded", []byte(`"value"`))
+	owner.setError(400, "503")
+	var value string
+	if err := c.Get("overloaded", &value); err != nil || value != "value" {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	// the other codes are answers of the node
+	rs := &Response{status: 400, body: []byte(`{"Status":"error","Code":"102"}`)}
+	if class := c.classify(rs, nil); class != classAuthoritative {
+		t.Errorf("code 102 classified as %d", class)
+	}
+}
+
+func TestNodeErrorReturned(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	fc.nodes[0].setStatus(500)
+	err := c.Put("alone", "value", 0)
+	if nerr, ok := err.(*NodeError); !ok || nerr.Status != 500 || nerr.Node != "node0" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
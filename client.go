@@ -1,144 +1,291 @@
 package ovoclient
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/maxzerbini/ovoclient/model"
 )
 
 const (
-	maxServer             = 128
-	minClusterCheckPeriod = 10
+	minClusterCheckPeriod     = Duration(10 * time.Second)
+	defaultClusterCheckPeriod = Duration(30 * time.Second)
+	defaultShutdownTimeout    = 10 * time.Second
+)
+
+var (
+	// ErrKeyNotFound is returned when the key is not stored in the cluster.
+	ErrKeyNotFound = errors.New("Key not found.")
+	// ErrNodeNotFound is returned when no node serves the hash slot of the key.
+	ErrNodeNotFound = errors.New("Node not found.")
+	// ErrNodeUnavailable is returned when no replica of the hash slot of the key answered.
+	ErrNodeUnavailable = errors.New("Node unavailable.")
+	// ErrNoTopology is returned when the client has not read the cluster topology yet.
+	ErrNoTopology = errors.New("Topology not available.")
+	// ErrClientClosed is returned by the operations started after Close.
+	ErrClientClosed = errors.New("Client closed.")
 )
 
 // OVO Client can connect to a OVO cluster and operates with OVO server APIs.
 // OVO Client is thread safe and can be shared from gorutines.
 type Client struct {
-	topology    *model.OvoTopology
-	clients     map[string]*Session
-	clientsHash map[int32]*Session
-	config      *Configuration
-	mux         *sync.RWMutex
-	tickChan    <-chan time.Time
-	doneChan    chan bool
+	table         atomic.Pointer[routingTable]
+	refresh       sync.Mutex // serializes the updates of the routing table
+	config        atomic.Pointer[Configuration]
+	ticker        *time.Ticker
+	doneChan      chan bool
+	savedTopology []byte // last topology saved in the topology file
+	seedMux       sync.Mutex
+	discovered    []Node // seed nodes resolved by the DNS discovery
+	health        *healthTracker
+	latency       *latencyTracker
+	hedges        *hedgeBudget
+	refresher     *refresher
+	hints         *hintStore
+	transport     *http.Transport // transport of the sessions when the configuration has none
+	metrics       clientMetrics
+	readTurn      uint64 // turn of the round-robin read routing
+	// lifecycle
+	closeOnce sync.Once
+	lifecycle sync.RWMutex
+	closed    bool
+	inflight  sync.WaitGroup
 }
 
 // Create a client loading the configuration from the default path.
 func NewClient() *Client {
-	client := &Client{clients: make(map[string]*Session, 0), clientsHash: make(map[int32]*Session, 128), mux: new(sync.RWMutex)}
-	client.tickChan = time.NewTicker(time.Second * minClusterCheckPeriod).C
-	client.doneChan = make(chan bool)
 	// load configuration from default path
-	client.config = LoadConfiguration("./config.json")
-	client.init()
-	go client.check()
-	return client
+	return NewClientFromConfigPath("./config.json")
+}
+
+// Create a client loading the configuration from the default path; it returns an error if the configuration is not valid.
+func NewClientE() (*Client, error) {
+	return NewClientFromConfigPathE("./config.json")
 }
 
 // Create a client using the input configuration.
 func NewClientFromConfig(config *Configuration) *Client {
-	client := &Client{clients: make(map[string]*Session, 0), clientsHash: make(map[int32]*Session, 128), mux: new(sync.RWMutex)}
-	client.config = config
-	client.tickChan = time.NewTicker(time.Second * 30).C
-	client.doneChan = make(chan bool)
-	client.init()
-	go client.check()
-	return client
+	return newClient(config)
+}
+
+// Create a client using the input configuration; it returns an error if the configuration is not valid.
+func NewClientFromConfigE(config *Configuration) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return newClientE(config)
 }
 
 // Create a client reading the configuration file from the config-path.
 func NewClientFromConfigPath(configpath string) *Client {
-	client := &Client{clients: make(map[string]*Session, 0), clientsHash: make(map[int32]*Session, 128), mux: new(sync.RWMutex)}
-	client.tickChan = time.NewTicker(time.Second * 30).C
-	client.doneChan = make(chan bool)
 	// load configuration
-	client.config = LoadConfiguration(configpath)
+	client := newClient(LoadConfiguration(configpath))
+	client.watchConfig(configpath)
+	return client
+}
+
+// Create a client reading the configuration file from the config-path; it returns an error if the configuration cannot be loaded.
+// With ReloadPeriod the file is watched and the changes are applied without restarting the client.
+func NewClientFromConfigPathE(configpath string) (*Client, error) {
+	config, err := LoadConfigurationE(configpath)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClientE(config)
+	if err != nil {
+		return nil, err
+	}
+	client.watchConfig(configpath)
+	return client, nil
+}
+
+// Create the client; in fail-fast mode a client without topology is returned anyway and loads the topology in background, as in lazy mode.
+func newClient(config *Configuration) *Client {
+	client := createClient(config)
+	if !client.hasTopology() {
+		client.logf("No seed node available, the topology will be loaded in background.\r\n")
+	}
+	client.start()
+	return client
+}
+
+// Create the client and start the background checks; in fail-fast mode it returns ErrNoSeedAvailable if no seed node answered.
+func newClientE(config *Configuration) (*Client, error) {
+	client := createClient(config)
+	if client.getConfig().StartupMode == StartupFailFast && !client.hasTopology() {
+		return nil, ErrNoSeedAvailable
+	}
+	client.start()
+	return client, nil
+}
+
+// Create the client on a copy of the configuration and load the topology.
+func createClient(config *Configuration) *Client {
+	client := &Client{health: newHealthTracker(), latency: newLatencyTracker(), hedges: newHedgeBudget(), refresher: newRefresher(), hints: newHintStore(),
+		transport: http.DefaultTransport.(*http.Transport).Clone()}
+	client.config.Store(config.clone())
+	client.loadHints()
 	client.init()
-	go client.check()
 	return client
 }
 
+// Start the background checks.
+func (c *Client) start() {
+	c.ticker = time.NewTicker(time.Duration(c.getConfig().ClusterCheckPeriod))
+	c.doneChan = make(chan bool)
+	go c.check()
+	go c.probe()
+	go c.refreshLoop()
+	go c.discover()
+	go c.maintainHints()
+}
+
 // init the client
 func (c *Client) init() {
-	if c.config.ClusterCheckPeriod < minClusterCheckPeriod {
-		c.config.ClusterCheckPeriod = minClusterCheckPeriod
+	setDefaults(c.getConfig())
+	empty, _ := c.newRoutingTable(nil, nil)
+	c.table.Store(empty)
+	if c.getConfig().SeedDiscovery.enabled() {
+		c.discoverSeeds()
 	}
-	// get topology
-	for _, node := range c.config.ClusterNodes {
-		s := &Session{}
+	if !c.loadTopology() {
+		c.loadTopologyFile()
+	}
+}
+
+// Set the default values of the configuration.
+func setDefaults(config *Configuration) {
+	if config.ClusterCheckPeriod == 0 {
+		config.ClusterCheckPeriod = defaultClusterCheckPeriod
+	} else if config.ClusterCheckPeriod < minClusterCheckPeriod {
+		config.ClusterCheckPeriod = minClusterCheckPeriod
+	}
+	if config.HealthCheckPeriod <= 0 {
+		config.HealthCheckPeriod = defaultHealthCheckPeriod
+	}
+	if config.RefreshDebounce <= 0 {
+		config.RefreshDebounce = defaultRefreshDebounce
+	}
+	if config.InactiveWriteTimeout <= 0 {
+		config.InactiveWriteTimeout = defaultInactiveWriteTimeout
+	}
+	if config.Codec == nil {
+		config.Codec = JSONCodec{}
+	}
+}
+
+// Get the current configuration; it is replaced when the configuration file is reloaded.
+func (c *Client) getConfig() *Configuration {
+	return c.config.Load()
+}
+
+// Create a session using the configured transport or, if not configured, the transport of the client,
+// so that closing its connections does not affect the other users of http.DefaultTransport.
+func (c *Client) newSession() *Session {
+	var transport http.RoundTripper = c.transport
+	if c.getConfig().Transport != nil {
+		transport = c.getConfig().Transport
+	}
+	return &Session{Client: &http.Client{Transport: transport}, state: &sessionState{}}
+}
+
+// Create the session of a cluster node; without a configured transport the session owns a copy of the transport of the client,
+// so that the retirement of the node closes only its own connections.
+func (c *Client) newNodeSession(node *model.OvoTopologyNode) *Session {
+	s := c.newSession()
+	if c.getConfig().Transport == nil {
+		s.Client.Transport = c.transport.Clone()
+		s.state.ownTransport = true
+	}
+	s.SetNode(node)
+	return s
+}
+
+// Read the topology from the seed nodes; false if no seed node answered with a valid topology.
+func (c *Client) loadTopology() bool {
+	for _, node := range c.seeds() {
+		s := c.newSession()
 		res := model.OvoResponseTopology{}
 		resp, err := s.Get(createTopologyEndpoint(node.Host, node.Port), nil, &res, nil)
 		if err != nil {
-			logInfof("Connection to %s:%s failed due to %v.\r\n", node.Host, node.Port, err)
+			c.logf("Connection to %s:%s failed due to %v.\r\n", node.Host, node.Port, err)
 		} else {
 			if resp.Status() == 200 {
-				c.topology = &res.Data
-				logInfof("Connection to %s:%s done: reading topology...\r\n", node.Host, node.Port)
-				break
+				c.logf("Connection to %s:%s done: reading topology...\r\n", node.Host, node.Port)
+				if c.adoptTopology(&res.Data) {
+					return true
+				}
 			}
 		}
 	}
-	c.rebuildClients()
+	return false
 }
 
-// Rebuild the client map.
-func (c *Client) rebuildClients() {
-	c.mux.Lock()
-	defer c.mux.Unlock()
-	// create inner clients
-	for _, node := range c.topology.Nodes {
-		s := &Session{}
-		s.SetNode(node)
-		for _, hash := range node.HashRange {
-			c.clientsHash[int32(hash)] = s
-		}
-		c.clients[node.Name] = s
-	}
+// Check if the topology was read.
+func (c *Client) hasTopology() bool {
+	return c.getTopology() != nil
+}
+
+// Get the current topology, nil if it was not read yet.
+func (c *Client) getTopology() *model.OvoTopology {
+	return c.routes().topology
 }
 
-// Check cluster topology.
-func (c *Client) checkTopology(topology model.OvoTopology) {
+// Read the topology from the nodes of the current topology; false if no node answered with a valid topology.
+func (c *Client) checkTopology(topology model.OvoTopology) bool {
 	// get topology
-	c.mux.Lock()
-	defer c.mux.Unlock()
 	for _, node := range topology.Nodes {
-		s := &Session{}
+		s := c.newSession()
 		res := model.OvoResponseTopology{}
 		resp, err := s.Get(createTopologyEndpoint(node.Host, strconv.Itoa(node.Port)), nil, &res, nil)
 		if err != nil {
-			logInfof("Connection to %s:%d failed due to %v.\r\n", node.Host, node.Port, err)
+			c.logf("Connection to %s:%d failed due to %v.\r\n", node.Host, node.Port, err)
 		} else {
 			if resp.Status() == 200 {
-				c.topology = &res.Data
-				logInfof("Connection to %s:%d done: reading topology...\r\n", node.Host, node.Port)
-				break
+				c.logf("Connection to %s:%d done: reading topology...\r\n", node.Host, node.Port)
+				if c.adoptTopology(&res.Data) {
+					return true
+				}
 			}
 		}
 	}
+	return false
 }
 
-// Check cluster topology and rebuild the client map.
+// Check cluster topology and rebuild the routing table.
+// When no known node answers the topology is read from the seed nodes, whose addresses can be different.
 func (c *Client) checkCluster() {
-	c.checkTopology(*c.topology)
-	c.rebuildClients()
-}
-
-// Get session from client map.
-func (c *Client) getSessionFromHash(hash int32) *Session {
-	c.mux.RLock()
-	defer c.mux.RUnlock()
-	return c.clientsHash[hash]
+	if topology := c.getTopology(); topology != nil && c.checkTopology(*topology) {
+		return
+	}
+	if !c.loadTopology() {
+		c.logf("Topology not refreshed: no node available.\r\n")
+	}
 }
 
 // Check cluster periodically.
 func (c *Client) check() {
+	// retry the seed nodes until the topology is read
+	retry := time.Second
+	for !c.hasTopology() {
+		select {
+		case <-time.After(retry):
+			c.checkCluster()
+			if retry *= 2; retry > time.Duration(c.getConfig().ClusterCheckPeriod) {
+				retry = time.Duration(c.getConfig().ClusterCheckPeriod)
+			}
+		case <-c.doneChan:
+			return
+		}
+	}
 	for {
 		select {
-		case <-c.tickChan:
+		case <-c.ticker.C:
 			c.checkCluster()
 		case <-c.doneChan:
 			return
@@ -146,152 +293,356 @@ func (c *Client) check() {
 	}
 }
 
-// Close the client.
+// Get a copy of the cluster topology.
+func (c *Client) Topology() model.OvoTopology {
+	topology := model.OvoTopology{Nodes: make([]*model.OvoTopologyNode, 0)}
+	current := c.getTopology()
+	if current == nil {
+		return topology
+	}
+	for _, node := range current.Nodes {
+		nd := *node
+		nd.HashRange = append([]int(nil), node.HashRange...)
+		nd.Twins = append([]string(nil), node.Twins...)
+		topology.Nodes = append(topology.Nodes, &nd)
+	}
+	return topology
+}
+
+// Close the client waiting at most 10 seconds for the in-flight operations.
+// Close can be called more than once; the operations started after Close fail with ErrClientClosed.
 func (c *Client) Close() {
-	c.doneChan <- true
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	c.Shutdown(ctx)
+}
+
+// Close the client waiting for the in-flight operations until the context is done.
+// The background checks are stopped, the changed hints are spooled and the idle connections are closed.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		c.lifecycle.Lock()
+		c.closed = true
+		c.lifecycle.Unlock()
+		c.ticker.Stop()
+		close(c.doneChan)
+	})
+	drained := make(chan bool)
+	go func() {
+		c.inflight.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.flushHints()
+	for _, s := range c.routes().sessions {
+		s.Client.CloseIdleConnections()
+	}
+	c.transport.CloseIdleConnections()
+	return err
+}
+
+// Register the start of an operation; it fails if the client is closed.
+func (c *Client) begin() error {
+	c.lifecycle.RLock()
+	defer c.lifecycle.RUnlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.inflight.Add(1)
+	return nil
+}
+
+// Register the end of an operation.
+func (c *Client) end() {
+	c.inflight.Done()
+}
+
+// Log a message using the configured logger.
+func (c *Client) logf(message string, args ...interface{}) {
+	if logger := c.getConfig().Logger; logger != nil {
+		logger.Printf(message, args...)
+	} else {
+		logInfof(message, args...)
+	}
+}
+
+// Get the error returned when no session serves a hash slot.
+func (c *Client) errNodeNotFound() error {
+	if !c.hasTopology() {
+		return ErrNoTopology
+	}
+	return ErrNodeNotFound
+}
+
+// A nodeOp sends an operation to a single node.
+type nodeOp func(ctx context.Context, s *Session) (*Response, error)
+
+// Check if the first attempt must skip the primary node.
+// A node whose last probes failed is skipped when at least one of its twins is alive,
+// a node marked as inactive by the cluster when at least one of its twins is alive and active.
+func (c *Client) skipPrimary(s *Session, twins []*Session) bool {
+	name := s.Node().Name
+	if c.health.isServing(name) {
+		return false
+	}
+	// an inactive primary is skipped when a twin is alive and active, a dead primary when a twin is alive
+	for _, st := range twins {
+		if c.health.isServing(st.Node().Name) || (!c.health.isAlive(name) && c.health.isAlive(st.Node().Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute a read operation on the replica chosen by the read routing (the primary node of the hash slot by default);
+// if the primary is not reachable the twins are tried in order.
+// The response of the primary is returned as it is, the responses of the twins are accepted only if successful.
+// It returns ErrNodeUnavailable if no replica answered, ErrKeyNotFound if the replicas that answered do not store the key.
+// With the Quorum and All read consistency the operation is sent concurrently to the primary and its twins and their values are compared.
+func (c *Client) read(hash int32, op nodeOp, cmp *comparator, opts ...CallOption) (*Response, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.end()
+	ctx := context.Background()
+	t := c.routes()
+	s := t.session(hash)
+	if s == nil {
+		return nil, c.errNodeNotFound()
+	}
+	op = c.classified(op)
+	twins := t.twinSessions(s)
+	if level := c.callOptions(opts).readConsistency; level != One {
+		return c.readReplicas(s, twins, op, cmp, level)
+	}
+	twins = c.servingFirst(twins)
+	answered := false
+	// a twin chosen by the read routing answers only if it has the value, otherwise the primary is asked
+	if first := c.routeRead(s, twins); first != s {
+		rs, err := c.timedOp(ctx, first, op)
+		if err == nil && rs.status == 200 {
+			return rs, nil
+		}
+		answered = err == nil
+		twins = withoutSession(twins, first)
+	}
+	if !c.skipPrimary(s, twins) {
+		var rs *Response
+		var err error
+		if c.getConfig().Hedge.Enabled && len(twins) > 0 {
+			rs, err = c.hedgedRead(ctx, s, twins, op)
+		} else {
+			rs, err = c.timedOp(ctx, s, op)
+		}
+		if err == nil {
+			return rs, nil
+		}
+	}
+	// try get data from the twins
+	for _, st := range twins {
+		rs, err := c.timedOp(ctx, st, op)
+		if err == nil && rs.status == 200 {
+			return rs, nil
+		}
+		answered = answered || err == nil
+	}
+	c.requestRefresh()
+	if !answered {
+		return nil, ErrNodeUnavailable
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Execute a write operation on the primary node of the hash slot; if the primary is not reachable the operation is sent to all its twins.
+// The writes to a primary marked as inactive by the cluster follow the InactiveWrites policy.
+// It returns the response of the primary or, after a failover, the responses of the twins that acknowledged the write;
+// after a failover it returns a *ReplicationError, durable if at least one replica acknowledged the write, because the primary missed it.
+// With the hinted handoff the mutation m of the write is recorded for the replicas that missed it.
+// With the Quorum and All write consistency the operation is sent concurrently to the primary and its twins.
+func (c *Client) write(hash int32, op nodeOp, m mutation, opts ...CallOption) (*Response, []*Response, error) {
+	if err := c.begin(); err != nil {
+		return nil, nil, err
+	}
+	defer c.end()
+	ctx := context.Background()
+	t := c.routes()
+	s := t.session(hash)
+	if s == nil {
+		return nil, nil, c.errNodeNotFound()
+	}
+	op = c.classified(op)
+	twins := t.twinSessions(s)
+	if o := c.callOptions(opts); o.writeConsistency != One {
+		return c.writeReplicas(s, twins, op, m, o.writeConsistency, o.conditional)
+	}
+	if !c.health.isActive(s.Node().Name) {
+		if err := c.inactiveWrite(s); err != nil {
+			return nil, nil, err
+		}
+	}
+	var err error
+	replicas := make([]ReplicaResult, 0, len(twins)+1)
+	if !c.skipPrimary(s, twins) {
+		rs, r := c.attempt(ctx, s, op, true)
+		if r.Err == nil {
+			c.supersedeHint(m, r.Node, rs)
+			return rs, nil, nil
+		}
+		err = r.Err
+		replicas = append(replicas, r)
+	} else {
+		err = ErrNodeUnavailable
+		replicas = append(replicas, ReplicaResult{Node: s.Node().Name, Primary: true, Err: errReplicaSkipped, Skipped: true})
+	}
+	if len(twins) == 0 {
+		c.requestRefresh()
+		return nil, nil, err
+	}
+	// try the operation on the twins
+	responses := make([]*Response, 0, len(twins))
+	for _, st := range twins {
+		rs, r := c.attempt(ctx, st, op, false)
+		if r.Err == nil {
+			responses = append(responses, rs)
+		}
+		replicas = append(replicas, r)
+	}
+	c.requestRefresh()
+	if len(responses) > 0 {
+		c.hint(m, replicas, responses[0])
+	}
+	return nil, responses, newReplicationError(One, One.required(len(twins)+1), replicas)
+}
+
+// Get the object data from a key storage response.
+func kvData(rs *Response) []byte {
+	return rs.Result.(*model.OvoResponse).Data.(*model.OvoKVResponse).Data
+}
+
+// Get the time to live of the object from a key storage response, zero if it does not expire or if the server does not report it.
+func kvTTL(rs *Response) int {
+	return rs.Result.(*model.OvoResponse).Data.(*model.OvoKVResponse).TTL
+}
+
+// Get the counter value from a counter response.
+func counterValue(rs *Response) int64 {
+	return rs.Result.(*model.OvoCounterResponse).Data.Value
+}
+
+// Get the time to live of the counter from a counter response, zero if it does not expire or if the server does not report it.
+func counterTTL(rs *Response) int {
+	return rs.Result.(*model.OvoCounterResponse).Data.TTL
+}
+
+// Get the digest of a key storage response.
+func kvDigest(rs *Response) (string, bool) {
+	if rs.status == 200 {
+		return "=" + string(kvData(rs)), true
+	}
+	return "", rs.status == 404
+}
 
+// Get the digest of a counter response.
+func counterDigest(rs *Response) (string, bool) {
+	if rs.status == 200 {
+		return "=" + strconv.FormatInt(counterValue(rs), 10), true
+	}
+	return "", rs.status == 404
+}
+
+// Check that all the twins accepted a conditional operation.
+func twinsAccepted(twins []*Response) error {
+	for _, rs := range twins {
+		if rs.status != 200 {
+			return errors.New("Key not found or value not equal.")
+		}
+	}
+	return nil
 }
 
 // Put data in raw format into the OVO storage.
 // The parameter key is the string associated to the object.
 // The parameter data is the array of bytes rapresenting the object.
 // The parameter ttl is the time to live of the object expressed in seconds; if it's zero the object will not be removed from the storage.
-func (c *Client) PutRawData(key string, data []byte, ttl int) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
+func (c *Client) PutRawData(key string, data []byte, ttl int, opts ...CallOption) error {
+	hash := c.slot(key)
 	mdata := &model.OvoKVRequest{Key: key, Data: data, Hash: hash, TTL: ttl}
-	resp := &model.OvoResponse{}
-	if s != nil {
-		_, err := s.Post(createKeyStorageEndpoint(s.node.Host, s.port), mdata, resp, nil)
-		if err != nil {
-			done := true
-			// try post on twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Post(createKeyStorageEndpoint(st.node.Host, st.port), mdata, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return nil
-			} else {
-				return err
-			}
-		}
-		return nil
-	}
-	return errors.New("Node not found.")
+	_, _, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Post(createKeyStorageEndpoint(s.Node().Host, s.port), mdata, &model.OvoResponse{}, nil)
+	}, putMutation(key, data, ttl), opts...)
+	return err
 }
 
 // Put the object in the storage serializing it in JSON.
 // The parameter ttl is the time to live of the object expressed in seconds; if it's zero the object will not be removed from the storage.
-func (c *Client) Put(key string, data interface{}, ttl int) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	bdata, err := json.Marshal(data)
+func (c *Client) Put(key string, data interface{}, ttl int, opts ...CallOption) error {
+	bdata, err := c.getConfig().Codec.Marshal(data)
 	if err != nil {
 		return err
 	}
-	mdata := &model.OvoKVRequest{Key: key, Data: bdata, Hash: hash, TTL: ttl}
-	resp := &model.OvoResponse{}
-	if s != nil {
-		_, err := s.Post(createKeyStorageEndpoint(s.node.Host, s.port), mdata, resp, nil)
-		if err != nil {
-			done := true
-			// try post on twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Post(createKeyStorageEndpoint(st.node.Host, st.port), mdata, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return nil
-			} else {
-				return err
-			}
-		}
-		return nil
-	}
-	return errors.New("Node not found.")
+	return c.PutRawData(key, bdata, ttl, opts...)
 }
 
 // Get a raw format rapresentation of the object stored in the OVO cluster.
-func (c *Client) GetRawData(key string) ([]byte, error) {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	resp := &model.OvoResponse{Data: &model.OvoKVResponse{}}
-	if s != nil {
-		rs, err := s.Get(createGetKeyStorageEndpoint(s.node.Host, s.port, key), nil, resp, nil)
-		if err != nil {
-			// try get data from the twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					rs, err := st.Get(createGetKeyStorageEndpoint(st.node.Host, st.port, key), nil, resp, nil)
-					if err == nil {
-						if resp != nil && rs.status == 200 {
-							return resp.Data.(*model.OvoKVResponse).Data, nil
-						}
-					}
-				}
-			}
-			c.checkCluster()
-			return nil, errors.New("Key not found.")
-		}
-		if resp != nil && rs.status == 200 {
-			return resp.Data.(*model.OvoKVResponse).Data, nil
-		} else if rs.status == 404 {
-			return nil, errors.New("Key not found.")
-		}
-		return nil, errors.New("Invalid data.")
+func (c *Client) GetRawData(key string, opts ...CallOption) ([]byte, error) {
+	rs, err := c.getRaw(key, opts...)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("Node not found.")
+	return kvData(rs), nil
+}
+
+// Read an object; it returns the response of the replica that stores it, or ErrKeyNotFound.
+func (c *Client) getRaw(key string, opts ...CallOption) (*Response, error) {
+	hash := c.slot(key)
+	cmp := &comparator{digest: kvDigest, repair: func(s *Session, rs *Response) (*Response, error) {
+		mdata := &model.OvoKVRequest{Key: key, Data: kvData(rs), Hash: hash}
+		return s.Post(createKeyStorageEndpoint(s.Node().Host, s.port), mdata, &model.OvoResponse{}, nil)
+	}}
+	rs, err := c.read(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Get(createGetKeyStorageEndpoint(s.Node().Host, s.port, key), nil, &model.OvoResponse{Data: &model.OvoKVResponse{}}, nil)
+	}, cmp, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if rs.status == 200 {
+		return rs, nil
+	} else if rs.status == 404 {
+		return nil, ErrKeyNotFound
+	}
+	return nil, errors.New("Invalid data.")
 }
 
 // Retrieve an object previously serialized in JSON.
-func (c *Client) Get(key string, data interface{}) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	resp := &model.OvoResponse{Data: &model.OvoKVResponse{}}
-	if s != nil {
-		rs, err := s.Get(createGetKeyStorageEndpoint(s.node.Host, s.port, key), nil, resp, nil)
-		if err != nil {
-			// try get data from the twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					rs, err := st.Get(createGetKeyStorageEndpoint(st.node.Host, st.port, key), nil, resp, nil)
-					if err == nil {
-						if rs.status == 200 {
-							err = json.Unmarshal(resp.Data.(*model.OvoKVResponse).Data, data)
-							return err
-						}
-					}
-				}
-			}
-			c.checkCluster()
-			return errors.New("Key not found.")
-		}
-		if rs.status == 200 {
-			err = json.Unmarshal(resp.Data.(*model.OvoKVResponse).Data, data)
-			return err
-		} else if rs.status == 404 {
-			return errors.New("Key not found.")
-		}
-		return errors.New("Invalid data.")
+func (c *Client) Get(key string, data interface{}, opts ...CallOption) error {
+	bdata, err := c.GetRawData(key, opts...)
+	if err != nil {
+		return err
 	}
-	return errors.New("Node not found.")
+	return c.getConfig().Codec.Unmarshal(bdata, data)
 }
 
 // Give the number of object store in every node (also replicated object are counted).
 func (c *Client) Count() map[string]int64 {
 	var count int64
-	counters := make(map[string]int64, len(c.topology.Nodes))
-	for _, node := range c.topology.Nodes {
+	counters := make(map[string]int64)
+	if c.begin() != nil {
+		return counters
+	}
+	defer c.end()
+	t := c.routes()
+	if t.topology == nil {
+		return counters
+	}
+	for _, node := range t.topology.Nodes {
 		resp := &model.OvoResponse{Data: new(int64)}
-		s := c.clients[node.Name]
-		rs, err := s.Get(createKeyStorageEndpoint(s.node.Host, s.port), nil, resp, nil)
+		s := t.sessions[node.Name]
+		rs, err := s.Get(createKeyStorageEndpoint(s.Node().Host, s.port), nil, resp, nil)
 		if err == nil {
 			if rs.status == 200 {
 				counters[node.Name] = *resp.Data.(*int64)
@@ -306,10 +657,18 @@ func (c *Client) Count() map[string]int64 {
 // Get the list of all the keys.
 func (c *Client) Keys() []string {
 	keys := make(map[string]bool)
-	for _, node := range c.topology.Nodes {
+	if c.begin() != nil {
+		return make([]string, 0)
+	}
+	defer c.end()
+	t := c.routes()
+	if t.topology == nil {
+		return make([]string, 0)
+	}
+	for _, node := range t.topology.Nodes {
 		resp := &model.OvoResponse{Data: &model.OvoKVKeys{}}
-		s := c.clients[node.Name]
-		rs, err := s.Get(createKeysEndpoint(s.node.Host, s.port), nil, resp, nil)
+		s := t.sessions[node.Name]
+		rs, err := s.Get(createKeysEndpoint(s.Node().Host, s.port), nil, resp, nil)
 		if err == nil {
 			if rs.status == 200 {
 				for _, k := range resp.Data.(*model.OvoKVKeys).Keys {
@@ -326,283 +685,181 @@ func (c *Client) Keys() []string {
 }
 
 // Delete an object from the storage.
-func (c *Client) Delete(key string) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	resp := &model.OvoResponse{}
-	if s != nil {
-		_, err := s.Delete(createGetKeyStorageEndpoint(s.node.Host, s.port, key), nil, resp, nil)
-		if err != nil {
-			// delete data calling all the twins
-			done := true
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Delete(createGetKeyStorageEndpoint(st.node.Host, st.port, key), nil, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return nil
-			} else {
-				return err
+func (c *Client) Delete(key string, opts ...CallOption) error {
+	hash := c.slot(key)
+	_, _, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Delete(createGetKeyStorageEndpoint(s.Node().Host, s.port, key), nil, &model.OvoResponse{}, nil)
+	}, deleteMutation(key), opts...)
+	return err
+}
+
+// Retrieve the raw format rapresentation of an object and remove it from the storage.
+func (c *Client) GetAndRemoveRawData(key string, opts ...CallOption) ([]byte, error) {
+	hash := c.slot(key)
+	rs, twins, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Get(createGetAndRemoveEndpoint(s.Node().Host, s.port, key), nil, &model.OvoResponse{Data: &model.OvoKVResponse{}}, nil)
+	}, deleteMutation(key), opts...)
+	if !IsDurable(err) {
+		return nil, err
+	}
+	if rs == nil {
+		// the object was removed from the twins
+		for _, rt := range twins {
+			if rt.status == 200 {
+				return kvData(rt), err
 			}
-		} else {
-			return nil
 		}
+		return nil, ErrKeyNotFound
+	}
+	if rs.status == 200 {
+		return kvData(rs), nil
+	} else if rs.status == 404 {
+		return nil, ErrKeyNotFound
 	}
-	return errors.New("Node not found.")
+	return nil, errors.New("Invalid data.")
 }
 
 // Retrieve an object previously serialized in JSON and remove it from the storage.
-func (c *Client) GetAndRemove(key string, data interface{}) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	resp := &model.OvoResponse{Data: &model.OvoKVResponse{}}
-	if s != nil {
-		rs, err := s.Get(createGetAndRemoveEndpoint(s.node.Host, s.port, key), nil, resp, nil)
-		if err != nil {
-			// try get data from the twins
-			done := true
-			found := true
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					rs, errt := st.Get(createGetAndRemoveEndpoint(st.node.Host, st.port, key), nil, resp, nil)
-					done = done && (errt == nil)
-					if errt == nil {
-						if rs.status == 200 {
-							errj := json.Unmarshal(resp.Data.(*model.OvoKVResponse).Data, data)
-							found = found && (errj == nil)
-						}
-					}
-
-				}
-			}
-			c.checkCluster()
-			if done && found {
-				return nil
-			} else if done && !found {
-				return errors.New("Key not found.")
-			} else {
-				return err
-			}
-		}
-		if rs.status == 200 {
-			err = json.Unmarshal(resp.Data.(*model.OvoKVResponse).Data, data)
-			return err
-		} else if rs.status == 404 {
-			return errors.New("Key not found.")
-		}
-		return errors.New("Invalid data.")
+func (c *Client) GetAndRemove(key string, data interface{}, opts ...CallOption) error {
+	bdata, err := c.GetAndRemoveRawData(key, opts...)
+	if err != nil {
+		return err
 	}
-	return errors.New("Node not found.")
+	return c.getConfig().Codec.Unmarshal(bdata, data)
 }
 
 // Update an object with the newData if the oldData is equal to the stored data.
-func (c *Client) UpdateValueIfEqual(key string, oldData interface{}, newData interface{}) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	bOldData, err := json.Marshal(oldData)
+func (c *Client) UpdateValueIfEqual(key string, oldData interface{}, newData interface{}, opts ...CallOption) error {
+	bOldData, err := c.getConfig().Codec.Marshal(oldData)
 	if err != nil {
 		return err
 	}
-	bNewData, err := json.Marshal(newData)
+	bNewData, err := c.getConfig().Codec.Marshal(newData)
 	if err != nil {
 		return err
 	}
-	mdata := &model.OvoKVUpdateRequest{Key: key, Data: bOldData, Hash: hash, NewData: bNewData}
-	resp := &model.OvoResponse{}
-	if s != nil {
-		rs, err := s.Post(createUpdateValueIfEqualEndpoint(s.node.Host, s.port, key), mdata, resp, nil)
-		if err != nil {
-			// try get data from the twins
-			done := true
-			found := true
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					rs, errt := st.Post(createUpdateValueIfEqualEndpoint(st.node.Host, st.port, key), mdata, resp, nil)
-					done = done && (errt == nil)
-					if errt == nil {
-						found = found && (rs.status == 200)
-					}
-				}
-			}
-			c.checkCluster()
-			if done && found {
-				return nil
-			} else if done && !found {
-				return errors.New("Key not found or value not equal.")
-			} else {
-				return err
-			}
-		}
-		if rs.status == 200 {
-			return nil
-		} else if rs.status == 403 {
-			return errors.New("Forbidden operation: old value is not equal to the stored value.")
-		} else if rs.status == 404 {
-			return errors.New("Key not found.")
+	return c.updateRawDataIfEqual(key, bOldData, bNewData, opts...)
+}
+
+// Update the raw data of an object if the oldData is equal to the stored data.
+func (c *Client) updateRawDataIfEqual(key string, oldData []byte, newData []byte, opts ...CallOption) error {
+	hash := c.slot(key)
+	mdata := &model.OvoKVUpdateRequest{Key: key, Data: oldData, Hash: hash, NewData: newData}
+	rs, twins, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Post(createUpdateValueIfEqualEndpoint(s.Node().Host, s.port, key), mdata, &model.OvoResponse{}, nil)
+	}, updateMutation(key, oldData, newData), append([]CallOption{conditionalWrite}, opts...)...)
+	if !IsDurable(err) {
+		return err
+	}
+	if rs == nil {
+		if errt := twinsAccepted(twins); errt != nil {
+			return errt
 		}
-		return errors.New("Invalid data.")
+		return err
 	}
-	return errors.New("Node not found.")
+	if rs.status == 200 {
+		return nil
+	} else if rs.status == 403 {
+		return errors.New("Forbidden operation: old value is not equal to the stored value.")
+	} else if rs.status == 404 {
+		return ErrKeyNotFound
+	}
+	return errors.New("Invalid data.")
 }
 
 // Increment (or decrement) the counter.
-func (c *Client) Increment(key string, value int64, ttl int) (int64, error) {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
+func (c *Client) Increment(key string, value int64, ttl int, opts ...CallOption) (int64, error) {
+	hash := c.slot(key)
 	mdata := &model.OvoCounter{Key: key, Value: value, Hash: hash, TTL: ttl}
-	resp := &model.OvoCounterResponse{}
-	if s != nil {
-		_, err := s.Put(createCountersEndpoint(s.node.Host, s.port), mdata, resp, nil)
-		if err != nil {
-			done := true
-			// try post on twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Put(createCountersEndpoint(st.node.Host, st.port), mdata, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return resp.Data.Value, nil
-			} else {
-				return 0, err
-			}
-		}
-		return resp.Data.Value, nil
-	}
-	return 0, errors.New("Node not found.")
+	rs, twins, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Put(createCountersEndpoint(s.Node().Host, s.port), mdata, &model.OvoCounterResponse{}, nil)
+	}, counterMutation(key, ttl), opts...)
+	return counterResult(rs, twins, err)
 }
 
 // Set the value of the counter.
-func (c *Client) SetCounter(key string, value int64, ttl int) (int64, error) {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
+func (c *Client) SetCounter(key string, value int64, ttl int, opts ...CallOption) (int64, error) {
+	hash := c.slot(key)
 	mdata := &model.OvoCounter{Key: key, Value: value, Hash: hash, TTL: ttl}
-	resp := &model.OvoCounterResponse{}
-	if s != nil {
-		_, err := s.Post(createCountersEndpoint(s.node.Host, s.port), mdata, resp, nil)
-		if err != nil {
-			done := true
-			// try post on twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Post(createCountersEndpoint(st.node.Host, st.port), mdata, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return resp.Data.Value, nil
-			} else {
-				return 0, err
-			}
+	rs, twins, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Post(createCountersEndpoint(s.Node().Host, s.port), mdata, &model.OvoCounterResponse{}, nil)
+	}, counterMutation(key, ttl), opts...)
+	return counterResult(rs, twins, err)
+}
+
+// Get the counter value written by the primary node or, after a failover, by the last twin.
+// The durable replication errors are returned with the value.
+func counterResult(rs *Response, twins []*Response, err error) (int64, error) {
+	if !IsDurable(err) {
+		return 0, err
+	}
+	if rs == nil {
+		if len(twins) == 0 {
+			return 0, err
 		}
-		return resp.Data.Value, nil
+		rs = twins[len(twins)-1]
 	}
-	return 0, errors.New("Node not found.")
+	return counterValue(rs), err
 }
 
 // Get the value of the counter.
-func (c *Client) GetCounter(key string) (int64, error) {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	resp := &model.OvoCounterResponse{}
-	if s != nil {
-		_, err := s.Get(createCounterEndpoint(s.node.Host, s.port, key), nil, resp, nil)
-		if err != nil {
-			done := true
-			// try post on twins
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Get(createCounterEndpoint(st.node.Host, st.port, key), nil, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return resp.Data.Value, nil
-			} else {
-				return 0, err
-			}
-		}
-		return resp.Data.Value, nil
+func (c *Client) GetCounter(key string, opts ...CallOption) (int64, error) {
+	rs, err := c.getCounter(key, opts...)
+	if err != nil {
+		return 0, err
 	}
-	return 0, errors.New("Node not found.")
+	return counterValue(rs), nil
 }
 
-// Delete a counter.
-func (c *Client) DeleteCounter(key string) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	resp := &model.OvoResponse{}
-	if s != nil {
-		_, err := s.Delete(createCounterEndpoint(s.node.Host, s.port, key), nil, resp, nil)
-		if err != nil {
-			// delete data calling all the twins
-			done := true
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					_, errt := st.Delete(createCounterEndpoint(st.node.Host, st.port, key), nil, resp, nil)
-					done = done && (errt == nil)
-				}
-			}
-			c.checkCluster()
-			if done {
-				return nil
-			} else {
-				return err
-			}
-		} else {
-			return nil
-		}
+// Read a counter; a missing counter is read as zero.
+func (c *Client) getCounter(key string, opts ...CallOption) (*Response, error) {
+	hash := c.slot(key)
+	cmp := &comparator{digest: counterDigest, repair: func(s *Session, rs *Response) (*Response, error) {
+		mdata := &model.OvoCounter{Key: key, Value: counterValue(rs), Hash: hash}
+		return s.Post(createCountersEndpoint(s.Node().Host, s.port), mdata, &model.OvoCounterResponse{}, nil)
+	}}
+	rs, err := c.read(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Get(createCounterEndpoint(s.Node().Host, s.port, key), nil, &model.OvoCounterResponse{}, nil)
+	}, cmp, opts...)
+	if err != nil {
+		return nil, err
 	}
-	return errors.New("Node not found.")
+	return rs, nil
+}
+
+// Delete a counter.
+func (c *Client) DeleteCounter(key string, opts ...CallOption) error {
+	hash := c.slot(key)
+	_, _, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Delete(createCounterEndpoint(s.Node().Host, s.port, key), nil, &model.OvoResponse{}, nil)
+	}, deleteCounterMutation(key), opts...)
+	return err
 }
 
 // Delete an object if its value is not changed.
-func (c *Client) DeleteValueIfEqual(key string, oldData interface{}) error {
-	hash := GetPositiveHashCode(key, maxServer)
-	s := c.getSessionFromHash(hash)
-	bOldData, err := json.Marshal(oldData)
+func (c *Client) DeleteValueIfEqual(key string, oldData interface{}, opts ...CallOption) error {
+	hash := c.slot(key)
+	bOldData, err := c.getConfig().Codec.Marshal(oldData)
 	if err != nil {
 		return err
 	}
 	mdata := &model.OvoKVRequest{Key: key, Data: bOldData, Hash: hash}
-	resp := &model.OvoResponse{}
-	if s != nil {
-		rs, err := s.Post(createDeleteValueIfEqualEndpoint(s.node.Host, s.port, key), mdata, resp, nil)
-		if err != nil {
-			// try get data from the twins
-			done := true
-			found := true
-			for _, nd := range c.topology.GetTwins(s.node.Twins) {
-				if st, ok := c.clients[nd.Name]; ok {
-					rs, errt := st.Post(createDeleteValueIfEqualEndpoint(st.node.Host, st.port, key), mdata, resp, nil)
-					done = done && (errt == nil)
-					if errt == nil {
-						found = found && (rs.status == 200)
-					}
-				}
-			}
-			c.checkCluster()
-			if done && found {
-				return nil
-			} else if done && !found {
-				return errors.New("Key not found or value not equal.")
-			} else {
-				return err
-			}
-		}
-		if rs.status == 200 {
-			return nil
-		} else if rs.status == 403 {
-			return errors.New("Forbidden operation: old value is not equal to the stored value.")
+	rs, twins, err := c.write(hash, func(ctx context.Context, s *Session) (*Response, error) {
+		return s.WithContext(ctx).Post(createDeleteValueIfEqualEndpoint(s.Node().Host, s.port, key), mdata, &model.OvoResponse{}, nil)
+	}, deleteMutation(key), append([]CallOption{conditionalWrite}, opts...)...)
+	if !IsDurable(err) {
+		return err
+	}
+	if rs == nil {
+		if errt := twinsAccepted(twins); errt != nil {
+			return errt
 		}
-		return errors.New("Invalid data.")
+		return err
+	}
+	if rs.status == 200 {
+		return nil
+	} else if rs.status == 403 {
+		return errors.New("Forbidden operation: old value is not equal to the stored value.")
 	}
-	return errors.New("Node not found.")
+	return errors.New("Invalid data.")
 }
@@ -0,0 +1,66 @@
+package ovoclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCloseIdempotent(t *testing.T) {
+	c := NewClientFromConfig(newFakeCluster(t, 1).config())
+	c.Close()
+	c.Close()
+	if err := c.Put("closed", "value", 0); err != ErrClientClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := c.GetRawData("closed"); err != ErrClientClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := c.Ping(context.Background()); err != ErrClientClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestShutdownDrainsInFlight(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	c := NewClientFromConfig(fc.config())
+	fc.nodes[0].setDelay(200 * time.Millisecond)
+	done := make(chan error)
+	go func() {
+		done <- c.Put("slow", "value", 0)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("in-flight Put failed: %v", err)
+		}
+	default:
+		t.Error("Shutdown returned before the in-flight Put")
+	}
+}
+
+func TestClientOwnTransport(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	s := c.routes().sessions[fc.nodes[0].node.Name]
+	// the session of a node owns a copy of the transport of the client
+	if tr, ok := s.Client.Transport.(*http.Transport); !ok || tr == http.DefaultTransport || tr == c.transport || !s.state.ownTransport {
+		t.Errorf("unexpected transport %T", s.Client.Transport)
+	}
+	other := NewClientFromConfig(fc.config())
+	defer other.Close()
+	if other.transport == c.transport {
+		t.Error("transport shared by two clients")
+	}
+}
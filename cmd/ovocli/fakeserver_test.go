@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// In memory OVO node used by the tests of the commands.
+type fakeNode struct {
+	mux      sync.Mutex
+	server   *httptest.Server
+	node     *model.OvoTopologyNode
+	cluster  *fakeCluster
+	data     map[string][]byte
+	counters map[string]int64
+	status   int // if not zero every request is answered with this status
+}
+
+// Cluster of two in memory OVO nodes, each one the twin of the other.
+type fakeCluster struct {
+	nodes    []*fakeNode
+	topology model.OvoTopology
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	fc := &fakeCluster{}
+	for i := 0; i < 2; i++ {
+		fn := &fakeNode{cluster: fc, data: make(map[string][]byte), counters: make(map[string]int64)}
+		fn.server = httptest.NewServer(fn)
+		addr := fn.server.Listener.Addr().(*net.TCPAddr)
+		fn.node = &model.OvoTopologyNode{Name: "node" + strconv.Itoa(i), Host: "127.0.0.1", Port: addr.Port, State: model.Active, HashRange: make([]int, 0)}
+		fc.nodes = append(fc.nodes, fn)
+		fc.topology.Nodes = append(fc.topology.Nodes, fn.node)
+		t.Cleanup(fn.server.Close)
+	}
+	for hash := 0; hash < model.MaxNodeNumber; hash++ {
+		nd := fc.nodes[hash%2].node
+		nd.HashRange = append(nd.HashRange, hash)
+	}
+	fc.nodes[0].node.Twins = []string{fc.nodes[1].node.Name}
+	fc.nodes[1].node.Twins = []string{fc.nodes[0].node.Name}
+	return fc
+}
+
+// Get the seed node of the cluster in host:port format.
+func (fc *fakeCluster) seed() string {
+	return "127.0.0.1:" + strconv.Itoa(fc.nodes[0].node.Port)
+}
+
+// Get the node with the name.
+func (fc *fakeCluster) node(name string) *fakeNode {
+	for _, fn := range fc.nodes {
+		if fn.node.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Store the value on every node.
+func (fc *fakeCluster) store(key string, data string) {
+	for _, fn := range fc.nodes {
+		fn.store(key, data)
+	}
+}
+
+// Set the counter on every node.
+func (fc *fakeCluster) setCounter(key string, value int64) {
+	for _, fn := range fc.nodes {
+		fn.mux.Lock()
+		fn.counters[key] = value
+		fn.mux.Unlock()
+	}
+}
+
+func (fn *fakeNode) setStatus(status int) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.status = status
+}
+
+func (fn *fakeNode) store(key string, data string) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.data[key] = []byte(data)
+}
+
+func (fn *fakeNode) value(key string) (string, bool) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	data, ok := fn.data[key]
+	return string(data), ok
+}
+
+func (fn *fakeNode) counter(key string) int64 {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	return fn.counters[key]
+}
+
+func (fn *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	if fn.status != 0 {
+		w.WriteHeader(fn.status)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/ovo/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "cluster":
+		reply(w, 200, &model.OvoResponseTopology{Status: "done", Data: fn.cluster.topology})
+	case path == "cluster/me":
+		reply(w, 200, &model.OvoResponseTopologyNode{Status: "done", Data: *fn.node})
+	case path == "keys":
+		keys := make([]string, 0, len(fn.data))
+		for k := range fn.data {
+			keys = append(keys, k)
+		}
+		reply(w, 200, &model.OvoResponse{Status: "done", Data: &model.OvoKVKeys{Keys: keys}})
+	case path == "keystorage" && r.Method == "GET":
+		reply(w, 200, &model.OvoResponse{Status: "done", Data: int64(len(fn.data))})
+	case path == "keystorage":
+		req := &model.OvoKVRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		fn.data[req.Key] = req.Data
+		reply(w, 200, &model.OvoResponse{Status: "done"})
+	case parts[0] == "keystorage" && len(parts) >= 2:
+		data, ok := fn.data[parts[1]]
+		if !ok {
+			reply(w, 404, &model.OvoResponse{Status: "error", Code: "101"})
+			return
+		}
+		op := ""
+		if len(parts) == 3 {
+			op = parts[2]
+		}
+		switch {
+		case op == "updatevalueifequal":
+			req := &model.OvoKVUpdateRequest{}
+			json.NewDecoder(r.Body).Decode(req)
+			if string(req.Data) != string(data) {
+				reply(w, 403, &model.OvoResponse{Status: "error", Code: "102"})
+				return
+			}
+			fn.data[parts[1]] = req.NewData
+			reply(w, 200, &model.OvoResponse{Status: "done"})
+		case op == "getandremove" || r.Method == "DELETE":
+			delete(fn.data, parts[1])
+			reply(w, 200, &model.OvoResponse{Status: "done", Data: &model.OvoKVResponse{Key: parts[1], Data: data}})
+		default:
+			reply(w, 200, &model.OvoResponse{Status: "done", Data: &model.OvoKVResponse{Key: parts[1], Data: data}})
+		}
+	case path == "counters":
+		req := &model.OvoCounter{}
+		json.NewDecoder(r.Body).Decode(req)
+		if r.Method == "PUT" {
+			fn.counters[req.Key] += req.Value
+		} else {
+			fn.counters[req.Key] = req.Value
+		}
+		reply(w, 200, &model.OvoCounterResponse{Status: "done", Data: model.OvoCounter{Key: req.Key, Value: fn.counters[req.Key]}})
+	case parts[0] == "counters" && len(parts) == 2:
+		value, ok := fn.counters[parts[1]]
+		if !ok {
+			reply(w, 404, &model.OvoCounterResponse{Status: "error", Code: "101"})
+			return
+		}
+		if r.Method == "DELETE" {
+			delete(fn.counters, parts[1])
+		}
+		reply(w, 200, &model.OvoCounterResponse{Status: "done", Data: model.OvoCounter{Key: parts[1], Value: value}})
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,514 @@
+// Command ovocli is a command-line client for the OVO cluster.
+//
+// Usage:
+//
+//	ovocli [-config config.json] [-nodes host:port,...] [-o raw|json] [-ttl seconds] <command> [arguments]
+//
+// The commands are:
+//
+//	get <key>                      print the value of the key
+//	put <key> [file]               store the content of the file (or of the standard input)
+//	del <key>                      delete the key
+//	getandremove <key>             print the value of the key and remove it
+//	cas <key> <old> <new>          replace the JSON value old with new
+//	incr <key> [delta]             increment the counter (default delta is 1)
+//	counter get|set|del <key> [value]
+//	keys [-prefix prefix]          list the keys
+//	count                          print the number of objects stored in every node
+//	topology                       print the cluster topology
+//	whereis <key>                  print the hash slot and the nodes serving the key
+//	slots                          print the primary and twin nodes of every hash slot
+//	export [-prefix p] [-counters c1,c2] [file]
+//	                               write the keys and the counters to a JSONL archive (default standard output)
+//	import [-concurrency n] [-conflict overwrite|skip|cas] [file]
+//	                               replay a JSONL archive (default standard input)
+//	verify [-prefix p] [-slots s1,s2] [-counters c1,c2] [-repair] [-concurrency n]
+//	                               compare the replicas of the keys and report the missing, divergent and orphan keys
+//	migrate -to host:port,... [-prefix p] [-counters c1,c2] [-conflict overwrite|skip|cas] [-concurrency n] [-rate n] [-checkpoint file] [-verify]
+//	                               copy the keys and the counters to another cluster
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maxzerbini/ovoclient"
+)
+
+var (
+	configPath = flag.String("config", "./config.json", "path of the JSON configuration file")
+	nodes      = flag.String("nodes", "", "comma separated list of host:port seed nodes (overrides the configuration file)")
+	output     = flag.String("o", "raw", "output format: raw or json")
+	ttl        = flag.Int("ttl", 0, "time to live in seconds of the written keys and counters")
+	verbose    = flag.Bool("v", false, "log the client requests")
+
+	// standard streams of the commands, replaced by the tests
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	ovoclient.LogEnabled = *verbose
+	// the process exits only here, after the deferred cleanups of the command
+	os.Exit(exitStatus(flag.Args()))
+}
+
+// Execute the command line and return the exit status of the process: 2 if the command is missing, 1 if the command failed.
+func exitStatus(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	if err := execute(args); err != nil {
+		fmt.Fprintf(stderr, "ovocli: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func usage() {
+	fmt.Fprintf(stderr, "Usage: ovocli [flags] <command> [arguments]\n\n")
+	fmt.Fprintf(stderr, "Commands: get, put, del, getandremove, cas, incr, counter, keys, count, topology, whereis, slots, export, import, verify, migrate\n\nFlags:\n")
+	flag.CommandLine.SetOutput(stderr)
+	flag.PrintDefaults()
+}
+
+// Create the client and execute the command; the client is closed before returning.
+func execute(args []string) error {
+	if *output != "raw" && *output != "json" {
+		return errors.New("invalid output format " + *output)
+	}
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = run(client, args[0], args[1:]); ovoclient.IsDurable(err) && err != nil {
+		// the write reached the replicas required by its consistency level but some replicas missed it
+		fmt.Fprintf(stderr, "ovocli: warning: %v\n", err)
+		return nil
+	}
+	return err
+}
+
+// Create the client from the seed nodes or from the configuration file.
+func newClient() (*ovoclient.Client, error) {
+	if *nodes == "" {
+		return ovoclient.NewClientFromConfigPathE(*configPath)
+	}
+	seeds, err := ovoclient.ParseNodes(*nodes)
+	if err != nil {
+		return nil, err
+	}
+	return ovoclient.NewClientFromConfigE(&ovoclient.Configuration{ClusterNodes: seeds})
+}
+
+// Execute the command.
+func run(client *ovoclient.Client, cmd string, args []string) error {
+	switch cmd {
+	case "get":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+		data, err := client.GetRawData(args[0])
+		if err != nil {
+			return err
+		}
+		return printValue(args[0], data)
+	case "put":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: put <key> [file]")
+		}
+		data, err := readInput(args[1:])
+		if err != nil {
+			return err
+		}
+		return client.PutRawData(args[0], data, *ttl)
+	case "del":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+		return client.Delete(args[0])
+	case "getandremove":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+		data, err := client.GetAndRemoveRawData(args[0])
+		if err != nil {
+			return err
+		}
+		return printValue(args[0], data)
+	case "cas":
+		if err := expectArgs(args, 3); err != nil {
+			return err
+		}
+		if !json.Valid([]byte(args[1])) || !json.Valid([]byte(args[2])) {
+			return errors.New("cas values must be valid JSON")
+		}
+		return client.UpdateValueIfEqual(args[0], json.RawMessage(args[1]), json.RawMessage(args[2]))
+	case "incr":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: incr <key> [delta]")
+		}
+		delta := int64(1)
+		if len(args) == 2 {
+			var err error
+			if delta, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return err
+			}
+		}
+		value, err := client.Increment(args[0], delta, *ttl)
+		if !ovoclient.IsDurable(err) {
+			return err
+		}
+		return printDurable(printCounter(args[0], value), err)
+	case "counter":
+		return runCounter(client, args)
+	case "keys":
+		return runKeys(client, args)
+	case "count":
+		counters := client.Count()
+		return printOutput(counters, func(w io.Writer) {
+			names := make([]string, 0, len(counters))
+			for name := range counters {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(w, "%s\t%d\n", name, counters[name])
+			}
+		})
+	case "topology":
+		topology := client.Topology()
+		return printOutput(topology, func(w io.Writer) {
+			for _, node := range topology.Nodes {
+				fmt.Fprintf(w, "%s\t%s:%d\t%s\thashes=%d\ttwins=%s\n", node.Name, node.Host, node.Port, node.State, len(node.HashRange), strings.Join(node.Twins, ","))
+			}
+		})
+	case "whereis":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+		return whereis(client, args[0])
+	case "slots":
+		routes := client.SlotMap()
+		return printOutput(routes, func(w io.Writer) {
+			for _, route := range routes {
+				fmt.Fprintf(w, "%d\t%s\t%s\n", route.Slot, route.Primary, strings.Join(route.Twins, ","))
+			}
+		})
+	case "export":
+		return runExport(client, args)
+	case "import":
+		return runImport(client, args)
+	case "verify":
+		return runVerify(client, args)
+	case "migrate":
+		return runMigrate(client, args)
+	}
+	return errors.New("unknown command " + cmd)
+}
+
+// Execute the counter sub-commands.
+func runCounter(client *ovoclient.Client, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: counter get|set|del <key> [value]")
+	}
+	key := args[1]
+	switch args[0] {
+	case "get":
+		value, err := client.GetCounter(key)
+		if err != nil {
+			return err
+		}
+		return printCounter(key, value)
+	case "set":
+		if err := expectArgs(args, 3); err != nil {
+			return err
+		}
+		value, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		if value, err = client.SetCounter(key, value, *ttl); !ovoclient.IsDurable(err) {
+			return err
+		}
+		return printDurable(printCounter(key, value), err)
+	case "del":
+		return client.DeleteCounter(key)
+	}
+	return errors.New("unknown counter command " + args[0])
+}
+
+// List the keys, optionally filtered by prefix.
+func runKeys(client *ovoclient.Client, args []string) error {
+	fs := newFlagSet("keys")
+	prefix := fs.String("prefix", "", "list only the keys starting with prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keys := make([]string, 0)
+	for _, k := range client.Keys() {
+		if strings.HasPrefix(k, *prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return printOutput(keys, func(w io.Writer) {
+		for _, k := range keys {
+			fmt.Fprintln(w, k)
+		}
+	})
+}
+
+// Export the key space to a file or to the standard output.
+func runExport(client *ovoclient.Client, args []string) error {
+	fs := newFlagSet("export")
+	prefix := fs.String("prefix", "", "export only the keys starting with prefix")
+	counters := fs.String("counters", "", "comma separated list of the counters to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts := ovoclient.ExportOptions{Prefix: *prefix}
+	if *counters != "" {
+		opts.Counters = strings.Split(*counters, ",")
+	}
+	w := stdout
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Create(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	stats, err := client.Export(context.Background(), w, opts)
+	fmt.Fprintf(stderr, "exported %d keys and %d counters, %d skipped\n", stats.Keys, stats.Counters, stats.Skipped)
+	return err
+}
+
+// Import an archive from a file or from the standard input.
+func runImport(client *ovoclient.Client, args []string) error {
+	fs := newFlagSet("import")
+	concurrency := fs.Int("concurrency", 4, "number of concurrent writers")
+	conflict := fs.String("conflict", "overwrite", "policy for the keys already stored: overwrite, skip or cas")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	policy, err := ovoclient.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return err
+	}
+	r := stdin
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	stats, err := client.Import(context.Background(), r, ovoclient.ImportOptions{Concurrency: *concurrency, TTL: *ttl, Conflict: policy})
+	fmt.Fprintf(stderr, "imported %d keys and %d counters, %d skipped, %d failed\n", stats.Keys, stats.Counters, stats.Skipped, stats.Failed)
+	return err
+}
+
+// Verify the replicas of the keys; it fails if some issues were not repaired.
+func runVerify(client *ovoclient.Client, args []string) error {
+	fs := newFlagSet("verify")
+	prefix := fs.String("prefix", "", "verify only the keys starting with prefix")
+	slots := fs.String("slots", "", "comma separated list of the hash slots to verify")
+	counters := fs.String("counters", "", "comma separated list of the counters to verify")
+	repair := fs.Bool("repair", false, "write the value of the primary node on the lagging twins")
+	concurrency := fs.Int("concurrency", 4, "number of keys verified concurrently")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts := ovoclient.VerifyOptions{Prefix: *prefix, Repair: *repair, Concurrency: *concurrency}
+	if *slots != "" {
+		for _, slot := range strings.Split(*slots, ",") {
+			n, err := strconv.ParseInt(strings.TrimSpace(slot), 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid hash slot %s", slot)
+			}
+			opts.Slots = append(opts.Slots, int32(n))
+		}
+	}
+	if *counters != "" {
+		opts.Counters = strings.Split(*counters, ",")
+	}
+	report, err := client.VerifyReplicas(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+	err = printOutput(report, func(w io.Writer) {
+		for _, issue := range report.Issues {
+			role := "twin"
+			if issue.Primary {
+				role = "primary"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\trepaired=%v\t%s\n", issue.Key, issue.Slot, issue.Kind, role, issue.Node, issue.Repaired, issue.Err)
+		}
+		for _, orphan := range report.Orphans {
+			fmt.Fprintf(w, "%s\t%d\torphan\t\t%s\n", orphan.Key, orphan.Slot, orphan.Node)
+		}
+		for _, node := range report.Unlisted {
+			fmt.Fprintf(w, "\t\tunlisted\t\t%s\t\t%s\n", node.Node, node.Err)
+		}
+	})
+	fmt.Fprintf(stderr, "verified %d keys, %d consistent, %d issues, %d repaired, %d orphans, %d unlisted nodes\n", report.Keys, report.Consistent, len(report.Issues), report.Repaired, len(report.Orphans), len(report.Unlisted))
+	if err != nil {
+		return err
+	}
+	if len(report.Issues) > report.Repaired || len(report.Orphans) > 0 || len(report.Unlisted) > 0 {
+		return errors.New("replicas not consistent")
+	}
+	return nil
+}
+
+// Copy the keys and the counters to the cluster of the target nodes.
+func runMigrate(client *ovoclient.Client, args []string) error {
+	fs := newFlagSet("migrate")
+	to := fs.String("to", "", "comma separated list of host:port seed nodes of the target cluster")
+	prefix := fs.String("prefix", "", "copy only the keys starting with prefix")
+	counters := fs.String("counters", "", "comma separated list of the counters to copy")
+	conflict := fs.String("conflict", "overwrite", "policy for the keys already stored on the target: overwrite, skip or cas")
+	concurrency := fs.Int("concurrency", 4, "number of concurrent copies")
+	rate := fs.Int("rate", 0, "maximum number of keys copied per second, unlimited if zero")
+	checkpoint := fs.String("checkpoint", "", "file where the progress is saved to resume an interrupted migration")
+	verify := fs.Bool("verify", false, "compare the values of the copied keys on the two clusters")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return errors.New("usage: migrate -to host:port,... [flags]")
+	}
+	policy, err := ovoclient.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return err
+	}
+	seeds, err := ovoclient.ParseNodes(*to)
+	if err != nil {
+		return err
+	}
+	target, err := ovoclient.NewClientFromConfigE(&ovoclient.Configuration{ClusterNodes: seeds})
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	opts := ovoclient.MigrateOptions{Prefix: *prefix, Conflict: policy, TTL: *ttl, Concurrency: *concurrency, Rate: *rate, Checkpoint: *checkpoint, Verify: *verify}
+	if *counters != "" {
+		opts.Counters = strings.Split(*counters, ",")
+	}
+	stats, err := ovoclient.NewMigrator(client, target, opts).Run(context.Background())
+	if perr := printOutput(stats, func(w io.Writer) {
+		for _, key := range stats.MismatchedKeys {
+			fmt.Fprintln(w, key)
+		}
+	}); err == nil {
+		err = perr
+	}
+	fmt.Fprintf(stderr, "copied %d keys and %d counters, %d skipped, %d failed\n", stats.Keys, stats.Counters, stats.Skipped, stats.Failed)
+	if *verify {
+		fmt.Fprintf(stderr, "verified %d keys, %d mismatched\n", stats.Verified, stats.Mismatched)
+	}
+	if err == nil && stats.Mismatched > 0 {
+		err = errors.New("values not equal after the copy")
+	}
+	return err
+}
+
+// Print the hash slot of the key and the nodes serving it.
+func whereis(client *ovoclient.Client, key string) error {
+	loc, err := client.Locate(key)
+	if err != nil {
+		return fmt.Errorf("hash slot %d: %v", loc.Slot, err)
+	}
+	return printOutput(loc, func(w io.Writer) {
+		fmt.Fprintf(w, "key\t%s\nhash\t%d\n", loc.Key, loc.Slot)
+		printReplica(w, "primary", loc.Primary)
+		for _, replica := range loc.Twins {
+			printReplica(w, "twin", replica)
+		}
+	})
+}
+
+// Print a node serving a key and the endpoints called by the key operations.
+func printReplica(w io.Writer, role string, replica ovoclient.ReplicaLocation) {
+	fmt.Fprintf(w, "%s\t%s\t%s:%d\t%s\talive=%v\n", role, replica.Name, replica.Host, replica.Port, replica.State, replica.Alive)
+	for _, endpoint := range replica.Endpoints {
+		fmt.Fprintf(w, "\t%s\n", endpoint)
+	}
+}
+
+// Create the flag set of a command; the parsing errors are returned and printed on the standard error together with the usage.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+func expectArgs(args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	return nil
+}
+
+// Read the value from the file or from the standard input.
+func readInput(args []string) ([]byte, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return ioutil.ReadAll(stdin)
+	}
+	return ioutil.ReadFile(args[0])
+}
+
+// Print the value as JSON or using the raw format.
+func printOutput(value interface{}, raw func(w io.Writer)) error {
+	if *output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	}
+	raw(stdout)
+	return nil
+}
+
+// Print a stored value; in JSON format values that are not valid JSON are printed as strings.
+func printValue(key string, data []byte) error {
+	if *output == "json" {
+		var value interface{} = string(data)
+		if json.Valid(data) {
+			value = json.RawMessage(data)
+		}
+		return printOutput(map[string]interface{}{"Key": key, "Value": value}, nil)
+	}
+	_, err := stdout.Write(data)
+	return err
+}
+
+func printCounter(key string, value int64) error {
+	return printOutput(map[string]interface{}{"Key": key, "Value": value}, func(w io.Writer) {
+		fmt.Fprintln(w, value)
+	})
+}
+
+// Return the error of the output or, if the output succeeded, the durable error of the write.
+func printDurable(err error, durable error) error {
+	if err != nil {
+		return err
+	}
+	return durable
+}
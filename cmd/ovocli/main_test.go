@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/maxzerbini/ovoclient"
+)
+
+// Execute the command line with the seed node of the cluster and return the exit status, the standard output and the standard error.
+func runCommand(t *testing.T, seed string, input string, args ...string) (int, string, string) {
+	*nodes, *configPath, *output, *ttl = seed, "", "raw", 0
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatalf("invalid arguments %v: %v", args, err)
+	}
+	var out, errOut bytes.Buffer
+	stdin, stdout, stderr = strings.NewReader(input), &out, &errOut
+	defer func() {
+		stdin, stdout, stderr = os.Stdin, os.Stdout, os.Stderr
+	}()
+	status := exitStatus(flag.Args())
+	return status, out.String(), errOut.String()
+}
+
+// Create a client of the cluster.
+func clusterClient(t *testing.T, fc *fakeCluster) *ovoclient.Client {
+	client, err := ovoclient.NewClientFromConfigE(&ovoclient.Configuration{ClusterNodes: []ovoclient.Node{{Host: "127.0.0.1", Port: strconv.Itoa(fc.nodes[0].node.Port)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// Find a key whose primary node is the node with the name.
+func keyOwnedBy(t *testing.T, fc *fakeCluster, name string) string {
+	client := clusterClient(t, fc)
+	defer client.Close()
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if loc, err := client.Locate(key); err == nil && loc.Primary.Name == name {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", name)
+	return ""
+}
+
+// Get the primary node of the key.
+func owner(t *testing.T, fc *fakeCluster, key string) *fakeNode {
+	client := clusterClient(t, fc)
+	defer client.Close()
+	loc, err := client.Locate(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fc.node(loc.Primary.Name)
+}
+
+func TestCommands(t *testing.T) {
+	fc := newFakeCluster(t)
+	fc.store("greeting", `"hello"`)
+	fc.store("plain", "text")
+	fc.setCounter("visits", 5)
+	commands := []struct {
+		input  string
+		args   []string
+		status int
+		stdout string // expected standard output
+		stderr string // expected in the standard error
+	}{
+		{args: []string{}, status: 2, stderr: "Usage: ovocli"},
+		{args: []string{"unknown"}, status: 1, stderr: "ovocli: unknown command unknown"},
+		{args: []string{"-o", "xml", "get", "greeting"}, status: 1, stderr: "invalid output format xml"},
+		{args: []string{"get"}, status: 1, stderr: "expected 1 arguments, got 0"},
+		{args: []string{"get", "greeting"}, stdout: `"hello"`},
+		{args: []string{"-o", "json", "get", "greeting"}, stdout: "{\n  \"Key\": \"greeting\",\n  \"Value\": \"hello\"\n}\n"},
+		{args: []string{"-o", "json", "get", "plain"}, stdout: "{\n  \"Key\": \"plain\",\n  \"Value\": \"text\"\n}\n"},
+		{args: []string{"get", "missing"}, status: 1, stderr: "ovocli: Key not found."},
+		{input: "stored", args: []string{"put", "written"}},
+		{args: []string{"get", "written"}, stdout: "stored"},
+		{args: []string{"put"}, status: 1, stderr: "usage: put <key> [file]"},
+		{args: []string{"put", "written", filepath.Join(t.TempDir(), "missing")}, status: 1, stderr: "no such file"},
+		{args: []string{"cas", "greeting", `"hello"`, `"world"`}},
+		{args: []string{"get", "greeting"}, stdout: `"world"`},
+		{args: []string{"cas", "greeting", "hello", "world"}, status: 1, stderr: "cas values must be valid JSON"},
+		{args: []string{"getandremove", "written"}, stdout: "stored"},
+		{args: []string{"incr", "visits", "2"}, stdout: "7\n"},
+		{args: []string{"incr", "visits", "two"}, status: 1, stderr: "invalid syntax"},
+		{args: []string{"-o", "json", "counter", "get", "visits"}, stdout: "{\n  \"Key\": \"visits\",\n  \"Value\": 7\n}\n"},
+		{args: []string{"counter", "set", "visits", "1"}, stdout: "1\n"},
+		{args: []string{"counter", "set", "visits"}, status: 1, stderr: "expected 3 arguments, got 2"},
+		{args: []string{"counter", "reset", "visits"}, status: 1, stderr: "unknown counter command reset"},
+		{args: []string{"counter", "del", "visits"}},
+		{args: []string{"keys", "-prefix", "gr"}, stdout: "greeting\n"},
+		{args: []string{"-o", "json", "keys"}, stdout: "[\n  \"greeting\",\n  \"plain\"\n]\n"},
+		{args: []string{"keys", "-limit", "1"}, status: 1, stderr: "flag provided but not defined: -limit"},
+		{args: []string{"count"}, stdout: "TotalCount\t4\nnode0\t2\nnode1\t2\n"},
+		{args: []string{"del", "plain"}},
+		{args: []string{"get", "plain"}, status: 1, stderr: "Key not found."},
+		{args: []string{"whereis"}, status: 1, stderr: "expected 1 arguments, got 0"},
+		{args: []string{"import", "-conflict", "merge"}, status: 1, stderr: "Invalid conflict policy merge."},
+		{args: []string{"verify", "-slots", "one"}, status: 1, stderr: "invalid hash slot one"},
+		{args: []string{"migrate", "-prefix", "gr"}, status: 1, stderr: "usage: migrate -to host:port,... [flags]"},
+	}
+	for _, cmd := range commands {
+		status, out, errOut := runCommand(t, fc.seed(), cmd.input, cmd.args...)
+		if status != cmd.status || out != cmd.stdout || !strings.Contains(errOut, cmd.stderr) {
+			t.Errorf("%v: unexpected status %d, output %q, error %q", cmd.args, status, out, errOut)
+		}
+	}
+}
+
+func TestLocationCommands(t *testing.T) {
+	fc := newFakeCluster(t)
+	key := keyOwnedBy(t, fc, "node1")
+	status, out, _ := runCommand(t, fc.seed(), "", "whereis", key)
+	if status != 0 || !strings.HasPrefix(out, "key\t"+key+"\n") || !strings.Contains(out, "primary\tnode1\t") || !strings.Contains(out, "twin\tnode0\t") {
+		t.Errorf("whereis returned %d, %q", status, out)
+	}
+	status, out, _ = runCommand(t, fc.seed(), "", "slots")
+	if status != 0 || !strings.HasPrefix(out, "0\tnode0\tnode1\n1\tnode1\tnode0\n") {
+		t.Errorf("slots returned %d, %q", status, out)
+	}
+	status, out, _ = runCommand(t, fc.seed(), "", "-o", "json", "topology")
+	if status != 0 || !strings.Contains(out, `"Name": "node0"`) || !strings.Contains(out, `"Name": "node1"`) {
+		t.Errorf("topology returned %d, %q", status, out)
+	}
+}
+
+func TestUnreachableCluster(t *testing.T) {
+	// the lazy client is created anyway and the command fails without a topology
+	status, out, errOut := runCommand(t, "127.0.0.1:1", "", "get", "key")
+	if status != 1 || out != "" || errOut != "ovocli: Topology not available.\n" {
+		t.Errorf("unexpected status %d, output %q, error %q", status, out, errOut)
+	}
+	status, _, errOut = runCommand(t, "127.0.0.1", "", "get", "key")
+	if status != 1 || !strings.HasPrefix(errOut, "ovocli: ") {
+		t.Errorf("invalid seed: unexpected status %d, error %q", status, errOut)
+	}
+}
+
+func TestDurableWarning(t *testing.T) {
+	fc := newFakeCluster(t)
+	key := keyOwnedBy(t, fc, "node1")
+	fc.node("node1").setStatus(503)
+	// the write acknowledged only by the twin succeeds with a warning
+	status, out, errOut := runCommand(t, fc.seed(), "value", "put", key)
+	if status != 0 || out != "" || !strings.HasPrefix(errOut, "ovocli: warning: Consistency") || !strings.Contains(errOut, "node1") {
+		t.Errorf("put: unexpected status %d, output %q, error %q", status, out, errOut)
+	}
+	if value, ok := fc.node("node0").value(key); !ok || value != "value" {
+		t.Errorf("twin value %q, %v", value, ok)
+	}
+	// the counters are printed together with the warning
+	status, out, errOut = runCommand(t, fc.seed(), "", "incr", key, "3")
+	if status != 0 || out != "3\n" || !strings.HasPrefix(errOut, "ovocli: warning: ") {
+		t.Errorf("incr: unexpected status %d, output %q, error %q", status, out, errOut)
+	}
+	// a write acknowledged by no replica fails
+	fc.node("node0").setStatus(503)
+	status, _, errOut = runCommand(t, fc.seed(), "value", "put", key)
+	if status != 1 || strings.Contains(errOut, "warning") {
+		t.Errorf("failed put: unexpected status %d, error %q", status, errOut)
+	}
+}
+
+func TestExportImportCommands(t *testing.T) {
+	fc := newFakeCluster(t)
+	fc.store("greeting", `"hello"`)
+	fc.setCounter("visits", 5)
+	archive := filepath.Join(t.TempDir(), "archive.jsonl")
+	status, _, errOut := runCommand(t, fc.seed(), "", "export", "-counters", "visits", archive)
+	if status != 0 || errOut != "exported 1 keys and 1 counters, 0 skipped\n" {
+		t.Fatalf("export: unexpected status %d, error %q", status, errOut)
+	}
+	status, out, _ := runCommand(t, fc.seed(), "", "export", "-prefix", "gr")
+	if status != 0 || !strings.Contains(out, `"Key":"greeting"`) || strings.Contains(out, "visits") {
+		t.Errorf("export to the standard output: unexpected status %d, output %q", status, out)
+	}
+	restored := newFakeCluster(t)
+	status, _, errOut = runCommand(t, restored.seed(), "", "import", archive)
+	if status != 0 || errOut != "imported 1 keys and 1 counters, 0 skipped, 0 failed\n" {
+		t.Fatalf("import: unexpected status %d, error %q", status, errOut)
+	}
+	if value, ok := owner(t, restored, "greeting").value("greeting"); !ok || value != `"hello"` || owner(t, restored, "visits").counter("visits") != 5 {
+		t.Errorf("archive not restored: %q, %v", value, ok)
+	}
+	// the archive is read from the standard input
+	status, _, errOut = runCommand(t, restored.seed(), out, "import", "-conflict", "skip", "-")
+	if status != 0 || errOut != "imported 0 keys and 0 counters, 1 skipped, 0 failed\n" {
+		t.Errorf("import from the standard input: unexpected status %d, error %q", status, errOut)
+	}
+	status, _, errOut = runCommand(t, restored.seed(), "{", "import")
+	if status != 1 || !strings.Contains(errOut, "invalid archive record at line 1") {
+		t.Errorf("invalid archive: unexpected status %d, error %q", status, errOut)
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	fc := newFakeCluster(t)
+	fc.store("greeting", `"hello"`)
+	key := keyOwnedBy(t, fc, "node1")
+	fc.node("node1").store(key, "value")
+	status, out, errOut := runCommand(t, fc.seed(), "", "verify")
+	if status != 1 || !strings.HasPrefix(out, key+"\t") || !strings.Contains(out, "\ttwin\tnode0\trepaired=false") ||
+		!strings.Contains(errOut, "verified 2 keys, 1 consistent, 1 issues, 0 repaired") || !strings.HasSuffix(errOut, "ovocli: replicas not consistent\n") {
+		t.Errorf("verify: unexpected status %d, output %q, error %q", status, out, errOut)
+	}
+	status, out, _ = runCommand(t, fc.seed(), "", "-o", "json", "verify", "-repair")
+	if status != 0 || !strings.Contains(out, `"Repaired": true`) {
+		t.Errorf("repair: unexpected status %d, output %q", status, out)
+	}
+	if value, ok := fc.node("node0").value(key); !ok || value != "value" {
+		t.Errorf("twin not repaired: %q, %v", value, ok)
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	source := newFakeCluster(t)
+	source.store("greeting", `"hello"`)
+	source.setCounter("visits", 5)
+	target := newFakeCluster(t)
+	status, out, errOut := runCommand(t, source.seed(), "", "-o", "json", "migrate", "-to", target.seed(), "-counters", "visits", "-verify")
+	if status != 0 || !strings.Contains(out, `"Keys": 1`) || errOut != "copied 1 keys and 1 counters, 0 skipped, 0 failed\nverified 2 keys, 0 mismatched\n" {
+		t.Errorf("migrate: unexpected status %d, output %q, error %q", status, out, errOut)
+	}
+	if value, ok := owner(t, target, "greeting").value("greeting"); !ok || value != `"hello"` || owner(t, target, "visits").counter("visits") != 5 {
+		t.Errorf("keys not copied: %q, %v", value, ok)
+	}
+	status, _, errOut = runCommand(t, source.seed(), "", "migrate", "-to", "127.0.0.1")
+	if status != 1 || !strings.HasPrefix(errOut, "ovocli: ") {
+		t.Errorf("invalid target: unexpected status %d, error %q", status, errOut)
+	}
+}
@@ -0,0 +1,22 @@
+package ovoclient
+
+import (
+	"encoding/json"
+)
+
+// A Codec serializes the objects stored with Put and read with Get.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec serializes the objects in JSON; it is the default codec.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
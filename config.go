@@ -1,27 +1,201 @@
 package ovoclient
-import(
-	"io/ioutil"
-	"os"
+
+import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables overriding the configuration file.
+const (
+	EnvClusterNodes       = "OVO_CLUSTER_NODES"        // comma separated list of host:port
+	EnvClusterCheckPeriod = "OVO_CLUSTER_CHECK_PERIOD" // duration (e.g. 30s) or number of seconds
+	EnvHealthCheckPeriod  = "OVO_HEALTH_CHECK_PERIOD"  // duration (e.g. 5s) or number of seconds
 )
+
 type Node struct {
 	Host string
 	Port string
 }
 
 type Configuration struct {
-	ClusterNodes []Node
-	ClusterCheckPeriod int
+	ClusterNodes          []Node
+	ClusterCheckPeriod    Duration            // period of the topology check
+	HealthCheckPeriod     Duration            // period of the probes of the cluster nodes
+	WriteConsistency      Consistency         // default write consistency (one, quorum or all)
+	ReadConsistency       Consistency         // default read consistency (one, quorum or all)
+	ReadRepair            bool                // write the winning value on the divergent replicas after a quorum read
+	Hedge                 HedgePolicy         // hedging of the reads sent to slow nodes
+	ReadRouting           ReadRouting         // routing of the reads among the replicas (primary, round-robin, random or least-latency)
+	InactiveWrites        InactiveWritePolicy // writes to a primary marked as inactive: redirect (default), queue or reject
+	InactiveWriteTimeout  Duration            // maximum wait of the queued writes
+	HintedHandoff         HintedHandoff       // record the writes missed by the nodes and replay them when the nodes are alive again
+	FailoverCodes         []string            // OVO error codes handled as node failures, like the 5xx statuses
+	RefreshDebounce       Duration            // minimum interval between the topology refreshes requested by the failed operations
+	SeedDiscovery         SeedDiscovery       // DNS discovery of the seed nodes
+	ReloadPeriod          Duration            // poll period of the configuration file of NewClientFromConfigPath, the file is not watched if not set
+	TopologyFile          string              // file where the last known topology is saved, used when no seed node is available at startup
+	RejectInvalidTopology bool                // keep the previous topology when the cluster returns a topology with uncovered or duplicated slots or unknown twins
+
+	// Options that can be set only in code.
+	Transport    http.RoundTripper `json:"-"` // transport of the HTTP sessions, shared by all the nodes; if nil every node gets its own copy of http.DefaultTransport
+	Codec        Codec             `json:"-"` // serialization of the objects, JSONCodec if nil
+	Logger       Logger            `json:"-"` // logger of the client, the package logger (see LogEnabled) if nil
+	StartupMode  StartupMode       `json:"-"` // StartupLazy by default
+	Partitioner  Partitioner       `json:"-"` // mapping of the keys on the hash slots, HashPartitioner if nil
+	EventHandler func(Event)       `json:"-"` // receives the events of the client
+	Resolver     Resolver          `json:"-"` // resolver of the seed discovery, net.DefaultResolver if nil
+
+	configPath string   // configuration file watched by the client created with New
+	overrides  []Option // options of New following the configuration file, applied again on every reload
+}
+
+// A Duration is a time.Duration that is read from JSON as a string (e.g. "30s") or as a number of seconds.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
 }
 
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+		return nil
+	case string:
+		parsed, err := parseDuration(v)
+		*d = parsed
+		return err
+	}
+	return errors.New("Invalid duration " + string(b) + ".")
+}
+
+// Parse a duration expressed as a Go duration string or as a number of seconds.
+func parseDuration(value string) (Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("Invalid duration " + value + ".")
+	}
+	return Duration(d), nil
+}
+
+// Load the configuration file; the process exits if the file cannot be read.
+//
+// Deprecated: use LoadConfigurationE.
 func LoadConfiguration(path string) *Configuration {
-	file, e := ioutil.ReadFile(path)
-    if e != nil {
-		log.Fatalf("Configuration file not found at %s", path)
-        os.Exit(1)
-    }
-    var jsontype *Configuration = &Configuration{}
-    json.Unmarshal(file, jsontype)
-	return jsontype;
-}
\ No newline at end of file
+	config, err := LoadConfigurationE(path)
+	if err != nil {
+		log.Fatalf("Configuration not loaded: %v", err)
+	}
+	return config
+}
+
+// Load the configuration file, apply the environment overrides and validate the result.
+func LoadConfigurationE(path string) (*Configuration, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Configuration file not found at %s: %v", path, err)
+	}
+	config := &Configuration{}
+	if err = json.Unmarshal(file, config); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s: %v", path, err)
+	}
+	if err = config.ApplyEnvironment(); err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Override the configuration with the environment variables OVO_CLUSTER_NODES, OVO_CLUSTER_CHECK_PERIOD and OVO_HEALTH_CHECK_PERIOD.
+func (config *Configuration) ApplyEnvironment() error {
+	if value := os.Getenv(EnvClusterNodes); value != "" {
+		nodes, err := ParseNodes(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", EnvClusterNodes, err)
+		}
+		config.ClusterNodes = nodes
+	}
+	if value := os.Getenv(EnvClusterCheckPeriod); value != "" {
+		d, err := parseDuration(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", EnvClusterCheckPeriod, err)
+		}
+		config.ClusterCheckPeriod = d
+	}
+	if value := os.Getenv(EnvHealthCheckPeriod); value != "" {
+		d, err := parseDuration(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", EnvHealthCheckPeriod, err)
+		}
+		config.HealthCheckPeriod = d
+	}
+	return nil
+}
+
+// Parse a comma separated list of host:port nodes.
+func ParseNodes(value string) ([]Node, error) {
+	nodes := make([]Node, 0)
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		i := strings.LastIndex(addr, ":")
+		if i < 0 {
+			return nil, errors.New("Invalid node address " + addr + ".")
+		}
+		nodes = append(nodes, Node{Host: addr[:i], Port: addr[i+1:]})
+	}
+	return nodes, nil
+}
+
+// Check that the configuration contains at least one node (or a seed discovery) and that every node has a valid host and port.
+func (config *Configuration) Validate() error {
+	if len(config.ClusterNodes) == 0 && !config.SeedDiscovery.enabled() {
+		return errors.New("Invalid configuration: no cluster nodes.")
+	}
+	if err := config.SeedDiscovery.validate(); err != nil {
+		return err
+	}
+	for _, node := range config.ClusterNodes {
+		if node.Host == "" || strings.ContainsAny(node.Host, " /:?#@") {
+			return fmt.Errorf("Invalid configuration: invalid host %q.", node.Host)
+		}
+		if port, err := strconv.Atoi(node.Port); err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("Invalid configuration: invalid port %q for host %s.", node.Port, node.Host)
+		}
+	}
+	if config.ClusterCheckPeriod < 0 || config.HealthCheckPeriod < 0 {
+		return errors.New("Invalid configuration: negative check period.")
+	}
+	if config.ReloadPeriod < 0 {
+		return errors.New("Invalid configuration: negative reload period.")
+	}
+	return nil
+}
+
+// Copy the configuration, so that the defaults set by the client do not change the configuration of the caller.
+func (config *Configuration) clone() *Configuration {
+	copy := *config
+	copy.ClusterNodes = append([]Node(nil), config.ClusterNodes...)
+	copy.FailoverCodes = append([]string(nil), config.FailoverCodes...)
+	return &copy
+}
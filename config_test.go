@@ -0,0 +1,84 @@
+package ovoclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigurationE(t *testing.T) {
+	path := writeConfig(t, `{"ClusterNodes":[{"Host":"localhost","Port":"5050"}],"ClusterCheckPeriod":"1m","HealthCheckPeriod":3}`)
+	config, err := LoadConfigurationE(path)
+	if err != nil {
+		t.Fatalf("LoadConfigurationE failed: %v", err)
+	}
+	if len(config.ClusterNodes) != 1 || config.ClusterCheckPeriod != Duration(time.Minute) || config.HealthCheckPeriod != Duration(3*time.Second) {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+}
+
+func TestLoadConfigurationErrors(t *testing.T) {
+	if _, err := LoadConfigurationE(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file not reported")
+	}
+	invalid := []string{
+		`{"ClusterNodes":`,
+		`{"ClusterNodes":[]}`,
+		`{"ClusterNodes":[{"Host":"","Port":"5050"}]}`,
+		`{"ClusterNodes":[{"Host":"localhost","Port":"http"}]}`,
+		`{"ClusterNodes":[{"Host":"localhost","Port":"70000"}]}`,
+		`{"ClusterNodes":[{"Host":"localhost","Port":"5050"}],"ClusterCheckPeriod":"soon"}`,
+		`{"ClusterNodes":[{"Host":"localhost","Port":"5050"}],"ReloadPeriod":"-1s"}`,
+	}
+	for _, content := range invalid {
+		if _, err := LoadConfigurationE(writeConfig(t, content)); err == nil {
+			t.Errorf("invalid configuration accepted: %s", content)
+		}
+	}
+}
+
+func TestConfigurationEnvironment(t *testing.T) {
+	path := writeConfig(t, `{"ClusterNodes":[{"Host":"localhost","Port":"5050"}]}`)
+	os.Setenv(EnvClusterNodes, "ovo1:5050, ovo2:5051")
+	os.Setenv(EnvClusterCheckPeriod, "45")
+	defer os.Unsetenv(EnvClusterNodes)
+	defer os.Unsetenv(EnvClusterCheckPeriod)
+	config, err := LoadConfigurationE(path)
+	if err != nil {
+		t.Fatalf("LoadConfigurationE failed: %v", err)
+	}
+	if len(config.ClusterNodes) != 2 || config.ClusterNodes[1] != (Node{Host: "ovo2", Port: "5051"}) {
+		t.Errorf("unexpected nodes %+v", config.ClusterNodes)
+	}
+	if config.ClusterCheckPeriod != Duration(45*time.Second) {
+		t.Errorf("unexpected period %v", config.ClusterCheckPeriod)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	b, err := json.Marshal(&Configuration{ClusterCheckPeriod: Duration(90 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Configuration{}
+	if err = json.Unmarshal(b, config); err != nil || config.ClusterCheckPeriod != Duration(90*time.Second) {
+		t.Errorf("round trip failed: %s -> %v, %v", b, config.ClusterCheckPeriod, err)
+	}
+}
+
+func TestNewClientFromConfigE(t *testing.T) {
+	if _, err := NewClientFromConfigE(&Configuration{}); err == nil {
+		t.Error("empty configuration accepted")
+	}
+}
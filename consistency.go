@@ -0,0 +1,348 @@
+package ovoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Consistency level of the operations on replicated data.
+type Consistency int
+
+const (
+	// The operation is executed on the primary node; the twins are used only when the primary fails.
+	One Consistency = iota
+	// The operation is executed on the primary node and its twins and it requires the majority of them.
+	Quorum
+	// The operation is executed on the primary node and its twins and it requires all of them.
+	All
+)
+
+func (l Consistency) String() string {
+	switch l {
+	case One:
+		return "one"
+	case Quorum:
+		return "quorum"
+	case All:
+		return "all"
+	}
+	return fmt.Sprintf("Consistency(%d)", int(l))
+}
+
+func (l Consistency) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Consistency) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "one", "":
+		*l = One
+	case "quorum":
+		*l = Quorum
+	case "all":
+		*l = All
+	default:
+		return errors.New("Invalid consistency level " + string(b) + ".")
+	}
+	return nil
+}
+
+// Number of replicas required by the consistency level.
+func (l Consistency) required(replicas int) int {
+	switch l {
+	case Quorum:
+		return replicas/2 + 1
+	case All:
+		return replicas
+	}
+	return 1
+}
+
+// A CallOption changes the behavior of a single operation.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	writeConsistency Consistency
+	readConsistency  Consistency
+	conditional      bool // the write is a compare-and-swap
+}
+
+// Set the write consistency of the operation.
+func UseWriteConsistency(level Consistency) CallOption {
+	return func(o *callOptions) {
+		o.writeConsistency = level
+	}
+}
+
+// Set the read consistency of the operation.
+func UseReadConsistency(level Consistency) CallOption {
+	return func(o *callOptions) {
+		o.readConsistency = level
+	}
+}
+
+// Mark a conditional write: with the Quorum and All consistency only the replicas that applied it acknowledge it.
+func conditionalWrite(o *callOptions) {
+	o.conditional = true
+}
+
+// Get the options of an operation starting from the client configuration.
+func (c *Client) callOptions(opts []CallOption) *callOptions {
+	config := c.getConfig()
+	o := &callOptions{writeConsistency: config.WriteConsistency, readConsistency: config.ReadConsistency}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Outcome of an operation on a replica.
+type ReplicaResult struct {
+	Node    string
+	Primary bool
+	Err     error         // nil if the replica acknowledged the operation
+	Skipped bool          // the replica was not attempted because it is not alive or inactive
+	Pending bool          // the replica did not answer before the operation returned
+	Latency time.Duration // time until the answer of the replica
+}
+
+// Error of the skipped replicas.
+var errReplicaSkipped = errors.New("Node skipped.")
+
+// Error of a replica that refused a conditional write.
+type rejectedError struct {
+	status int
+}
+
+func (e *rejectedError) Error() string {
+	if e.status == 404 {
+		return "Key not found."
+	}
+	return "Value not equal."
+}
+
+// A ReplicationError is returned when an operation is not acknowledged by the replicas required by its consistency level,
+// or when a write with the One consistency failed over to the twins and some replicas missed it.
+type ReplicationError struct {
+	Consistency Consistency
+	Required    int              // number of acknowledgements required
+	Acks        int              // number of replicas that acknowledged the operation
+	Failed      map[string]error // errors of the failed replicas by node name
+	Replicas    []ReplicaResult  // outcome of every replica of the operation, the primary first
+	Durable     bool             // the operation was acknowledged by the replicas required by the consistency level
+}
+
+// Check if a write error still met the durability of its consistency level: the error is nil or a durable *ReplicationError.
+func IsDurable(err error) bool {
+	if err == nil {
+		return true
+	}
+	rerr, ok := err.(*ReplicationError)
+	return ok && rerr.Durable
+}
+
+// Get the names of the replicas that missed the operation.
+func (e *ReplicationError) Missed() []string {
+	names := make([]string, 0, len(e.Replicas))
+	for _, r := range e.Replicas {
+		if r.Err != nil {
+			names = append(names, r.Node)
+		}
+	}
+	return names
+}
+
+func (e *ReplicationError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, name+": "+e.Failed[name].Error())
+	}
+	if e.Durable {
+		return fmt.Sprintf("Consistency %s reached with %d replicas but some replicas missed the write (failed %s).", e.Consistency, e.Acks, strings.Join(failures, ", "))
+	}
+	return fmt.Sprintf("Consistency %s not reached: %d of %d required replicas acknowledged (failed %s).", e.Consistency, e.Acks, e.Required, strings.Join(failures, ", "))
+}
+
+// Create the replication error of the results of the replicas.
+func newReplicationError(level Consistency, required int, replicas []ReplicaResult) *ReplicationError {
+	e := &ReplicationError{Consistency: level, Required: required, Failed: make(map[string]error), Replicas: replicas}
+	for _, r := range replicas {
+		if r.Err != nil {
+			e.Failed[r.Node] = r.Err
+		} else if !r.Pending {
+			e.Acks++
+		}
+	}
+	e.Durable = e.Acks >= required
+	return e
+}
+
+// Send the operation to a replica and measure its outcome.
+func (c *Client) attempt(ctx context.Context, s *Session, op nodeOp, primary bool) (*Response, ReplicaResult) {
+	start := time.Now()
+	rs, err := op(ctx, s)
+	return rs, ReplicaResult{Node: s.Node().Name, Primary: primary, Err: err, Latency: time.Since(start)}
+}
+
+// Execute a write operation concurrently on the primary node and its twins.
+// It returns as soon as the replicas required by the consistency level acknowledge the write:
+// the response of the primary if it was received, otherwise the responses of the twins.
+// A failed write waits for all the replicas, so that the error reports every acknowledgement.
+// A conditional write is acknowledged only by the replicas that applied it; when all the replicas that answered refused it
+// the refusal of the primary is returned.
+// With the hinted handoff the mutation m is recorded for the replicas that failed before the write returned.
+func (c *Client) writeReplicas(s *Session, twins []*Session, op nodeOp, m mutation, level Consistency, conditional bool) (*Response, []*Response, error) {
+	type result struct {
+		index int
+		rs    *Response
+		ReplicaResult
+	}
+	replicas := append([]*Session{s}, twins...)
+	required := level.required(len(replicas))
+	results := make(chan result, len(replicas))
+	outcomes := make([]ReplicaResult, len(replicas))
+	for i, st := range replicas {
+		outcomes[i] = ReplicaResult{Node: st.Node().Name, Primary: i == 0, Pending: true}
+		c.inflight.Add(1)
+		go func(i int, st *Session) {
+			defer c.inflight.Done()
+			rs, r := c.attempt(context.Background(), st, op, i == 0)
+			results <- result{index: i, rs: rs, ReplicaResult: r}
+		}(i, st)
+	}
+	var primary, refused *Response
+	acked := make([]*Response, 0, len(twins))
+	failed := 0
+	for i := 0; i < len(replicas); i++ {
+		r := <-results
+		if conditional && r.Err == nil && r.rs.status >= 300 {
+			r.Err = &rejectedError{status: r.rs.status}
+			if r.index == 0 {
+				refused = r.rs
+			}
+		}
+		outcomes[r.index] = r.ReplicaResult
+		if r.Err != nil {
+			failed++
+		} else if r.index == 0 {
+			primary = r.rs
+		} else {
+			acked = append(acked, r.rs)
+		}
+		acks := len(acked)
+		if primary != nil {
+			acks++
+		}
+		if acks >= required {
+			if failed > 0 {
+				c.requestRefresh()
+				if primary != nil {
+					c.hint(m, outcomes, primary)
+				} else {
+					c.hint(m, outcomes, acked[0])
+				}
+			}
+			if primary != nil {
+				return primary, nil, nil
+			}
+			return nil, acked, nil
+		}
+	}
+	if refused != nil && len(acked) == 0 {
+		// no replica applied the write: the condition is not met
+		return refused, nil, nil
+	}
+	c.requestRefresh()
+	return nil, nil, newReplicationError(level, required, outcomes)
+}
+
+// A comparator compares the values read from the replicas and writes the winning value on the divergent ones.
+type comparator struct {
+	digest func(rs *Response) (string, bool)                     // comparable value of a response, false if the response is not a valid answer
+	repair func(s *Session, winner *Response) (*Response, error) // write the winning value on a replica
+}
+
+// Execute a read operation concurrently on the primary node and its twins and wait for all the answers.
+// The value read by most of the replicas wins, the primary value wins the ties;
+// with read repair the winning value is written in background on the divergent replicas (missing values are not deleted and the repaired values do not expire).
+func (c *Client) readReplicas(s *Session, twins []*Session, op nodeOp, cmp *comparator, level Consistency) (*Response, error) {
+	type answer struct {
+		session *Session
+		rs      *Response
+		digest  string
+		err     error
+		latency time.Duration
+	}
+	replicas := append([]*Session{s}, twins...)
+	answers := make([]answer, len(replicas))
+	var wg sync.WaitGroup
+	for i, st := range replicas {
+		wg.Add(1)
+		go func(i int, st *Session) {
+			defer wg.Done()
+			rs, r := c.attempt(context.Background(), st, op, i == 0)
+			answers[i] = answer{session: st, rs: rs, err: r.Err, latency: r.Latency}
+			if r.Err == nil {
+				var ok bool
+				if answers[i].digest, ok = cmp.digest(rs); !ok {
+					answers[i].err = errors.New("Invalid data.")
+				}
+			}
+		}(i, st)
+	}
+	wg.Wait()
+	required := level.required(len(replicas))
+	outcomes := make([]ReplicaResult, len(answers))
+	failed := 0
+	votes := make(map[string]int)
+	var winner *answer
+	for i := range answers {
+		a := &answers[i]
+		outcomes[i] = ReplicaResult{Node: a.session.Node().Name, Primary: i == 0, Err: a.err, Latency: a.latency}
+		if a.err != nil {
+			failed++
+			continue
+		}
+		votes[a.digest]++
+		if winner == nil || votes[a.digest] > votes[winner.digest] {
+			winner = a
+		}
+	}
+	if failed > 0 {
+		c.requestRefresh()
+	}
+	if acks := len(replicas) - failed; acks < required {
+		return nil, newReplicationError(level, required, outcomes)
+	}
+	if c.getConfig().ReadRepair && winner.rs.status == 200 {
+		for i := range answers {
+			if a := &answers[i]; a.err == nil && a.digest != winner.digest {
+				c.repair(a.session, winner.rs, cmp)
+			}
+		}
+	}
+	return winner.rs, nil
+}
+
+// Write in background the winning value on a divergent replica.
+func (c *Client) repair(s *Session, winner *Response, cmp *comparator) {
+	c.inflight.Add(1)
+	go func() {
+		defer c.inflight.Done()
+		if _, err := cmp.repair(s, winner); err != nil {
+			c.logf("Read repair on node %s failed due to %v.\r\n", s.Node().Name, err)
+		} else {
+			c.logf("Read repair on node %s done.\r\n", s.Node().Name)
+		}
+	}()
+}
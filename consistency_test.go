@@ -0,0 +1,228 @@
+package ovoclient
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteQuorum(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	fc.setTwins(2)
+	config := fc.config()
+	config.WriteConsistency = Quorum
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("quorum")
+	down := fc.node(owner.node.Twins[0])
+	up := fc.node(owner.node.Twins[1])
+	down.setDown(true)
+	if err := c.Put("quorum", "value", 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	for _, fn := range []*fakeNode{owner, up} {
+		if data, ok := fn.value("quorum"); !ok || string(data) != `"value"` {
+			t.Errorf("%s not written: %s", fn.node.Name, data)
+		}
+	}
+	// the second twin failure makes the quorum unreachable
+	up.setDown(true)
+	err := c.Put("quorum", "value2", 0)
+	rerr, ok := err.(*ReplicationError)
+	if !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if rerr.Required != 2 || rerr.Acks != 1 || rerr.Failed[down.node.Name] == nil || rerr.Failed[up.node.Name] == nil {
+		t.Errorf("unexpected replication error %+v", rerr)
+	}
+}
+
+func TestWriteAllPerCall(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("all")
+	twin := fc.node(owner.node.Twins[0])
+	if _, err := c.Increment("all", 5, 0, UseWriteConsistency(All)); err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	if owner.counter("all") != 5 || twin.counter("all") != 5 {
+		t.Errorf("counter not replicated: %d %d", owner.counter("all"), twin.counter("all"))
+	}
+	twin.setDown(true)
+	// the default consistency writes only on the primary
+	if err := c.Put("all", "value", 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	err := c.Put("all", "value", 0, UseWriteConsistency(All))
+	if err == nil || !strings.Contains(err.Error(), twin.node.Name) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReadQuorumWithRepair(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	fc.setTwins(2)
+	config := fc.config()
+	config.ReadConsistency = Quorum
+	config.ReadRepair = true
+	c := NewClientFromConfig(config)
+	owner := fc.owner("drift")
+	stale := fc.node(owner.node.Twins[1])
+	owner.store("drift", []byte(`"new"`))
+	fc.node(owner.node.Twins[0]).store("drift", []byte(`"new"`))
+	stale.store("drift", []byte(`"old"`))
+	var value string
+	if err := c.Get("drift", &value); err != nil || value != "new" {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	// Close waits for the read repair
+	c.Close()
+	if data, _ := stale.value("drift"); string(data) != `"new"` {
+		t.Errorf("stale replica not repaired: %s", data)
+	}
+}
+
+func TestReadRepairTTL(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.ReadRepair = true
+	c := NewClientFromConfig(config)
+	owner := fc.owner("expiring")
+	twin := fc.node(owner.node.Twins[0])
+	c.Put("expiring", "value", 60, UseWriteConsistency(All))
+	c.SetCounter("expiring", 3, 120, UseWriteConsistency(All))
+	// the twin lost the writes
+	twin.mux.Lock()
+	twin.data["expiring"] = []byte(`"old"`)
+	twin.counters["expiring"] = 1
+	twin.ttls = make(map[string]int)
+	twin.mux.Unlock()
+	var value string
+	c.Get("expiring", &value, UseReadConsistency(All))
+	c.GetCounter("expiring", UseReadConsistency(All))
+	// Close waits for the read repair
+	c.Close()
+	// the repaired values do not expire
+	if data, _ := twin.value("expiring"); string(data) != `"value"` || twin.ttl("expiring") != 0 {
+		t.Errorf("value repaired as %s with ttl %d", data, twin.ttl("expiring"))
+	}
+	if twin.counter("expiring") != 3 || twin.ttl("#expiring") != 0 {
+		t.Errorf("counter repaired as %d with ttl %d", twin.counter("expiring"), twin.ttl("#expiring"))
+	}
+}
+
+func TestReadQuorumPerCall(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("tie")
+	twin := fc.node(owner.node.Twins[0])
+	twin.counters["tie"] = 7
+	// the primary wins the ties, the missing counter is not repaired
+	if value, err := c.GetCounter("tie", UseReadConsistency(Quorum)); err != nil || value != 0 {
+		t.Errorf("GetCounter returned %d, %v", value, err)
+	}
+	twin.setDown(true)
+	if _, err := c.GetCounter("tie", UseReadConsistency(All)); err == nil {
+		t.Error("read consistency all reached with a replica down")
+	}
+	if _, err := c.GetCounter("tie", UseReadConsistency(One)); err != nil {
+		t.Errorf("GetCounter failed: %v", err)
+	}
+}
+
+func TestConditionalWriteQuorum(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	fc.setTwins(2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("cas")
+	twins := []*fakeNode{fc.node(owner.node.Twins[0]), fc.node(owner.node.Twins[1])}
+	// the twins refuse the update applied by the primary
+	owner.store("cas", []byte(`"old"`))
+	for _, fn := range twins {
+		fn.store("cas", []byte(`"other"`))
+	}
+	err := c.UpdateValueIfEqual("cas", "old", "new", UseWriteConsistency(Quorum))
+	rerr, ok := err.(*ReplicationError)
+	if !ok || rerr.Acks != 1 || len(rerr.Failed) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the primary refuses the update applied by the twins
+	owner.store("cas", []byte(`"other"`))
+	for _, fn := range twins {
+		fn.store("cas", []byte(`"old"`))
+	}
+	if err := c.UpdateValueIfEqual("cas", "old", "new", UseWriteConsistency(Quorum)); err != nil {
+		t.Errorf("UpdateValueIfEqual failed: %v", err)
+	}
+	// all the replicas refuse the delete
+	err = c.DeleteValueIfEqual("cas", "old", UseWriteConsistency(All))
+	if _, ok := err.(*ReplicationError); ok || err == nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, ok := twins[0].value("cas"); !ok {
+		t.Error("value deleted")
+	}
+}
+
+func TestConsistencyText(t *testing.T) {
+	var level Consistency
+	if err := level.UnmarshalText([]byte("Quorum")); err != nil || level != Quorum {
+		t.Errorf("unexpected level %v, %v", level, err)
+	}
+	if err := level.UnmarshalText([]byte("most")); err == nil {
+		t.Error("invalid level accepted")
+	}
+}
+
+func TestFailoverReplicationError(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	fc.setTwins(2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("partial")
+	down := fc.node(owner.node.Twins[0])
+	up := fc.node(owner.node.Twins[1])
+	owner.setStatus(503)
+	down.setStatus(503)
+	err := c.Put("partial", "value", 0)
+	rerr, ok := err.(*ReplicationError)
+	if !ok || !rerr.Durable || !IsDurable(err) || rerr.Acks != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(rerr.Replicas) != 3 || !rerr.Replicas[0].Primary || rerr.Replicas[0].Node != owner.node.Name {
+		t.Fatalf("unexpected replicas %+v", rerr.Replicas)
+	}
+	for _, r := range rerr.Replicas {
+		if (r.Node == up.node.Name) != (r.Err == nil) || r.Latency <= 0 {
+			t.Errorf("unexpected replica %+v", r)
+		}
+	}
+	if missed := rerr.Missed(); len(missed) != 2 {
+		t.Errorf("unexpected missed replicas %v", missed)
+	}
+	// the counters are returned with the durable errors
+	if value, err := c.Increment("partial", 3, 0); value != 3 || !IsDurable(err) || err == nil {
+		t.Errorf("Increment returned %d, %v", value, err)
+	}
+	// no replica acknowledged the write
+	up.setStatus(503)
+	if err := c.Put("partial", "value", 0); IsDurable(err) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFailoverWriteReported(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("reported")
+	owner.setStatus(503)
+	// a write acknowledged by all the twins reports the primary that missed it
+	err := c.Put("reported", "value", 0)
+	rerr, ok := err.(*ReplicationError)
+	if !ok || !rerr.Durable || !IsDurable(err) || len(rerr.Missed()) != 1 || rerr.Missed()[0] != owner.node.Name {
+		t.Errorf("unexpected error %v", err)
+	}
+}
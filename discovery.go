@@ -0,0 +1,130 @@
+package ovoclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const discoveryTimeout = 5 * time.Second
+
+// A Resolver resolves the DNS records of the seed nodes; *net.Resolver is a Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNS discovery of the seed nodes.
+// The seeds are resolved from the A/AAAA records of Name or from the SRV record Service, and they are added to ClusterNodes.
+type SeedDiscovery struct {
+	Name    string   // host name resolved to the seed addresses
+	Port    string   // port of the seeds resolved from Name
+	Service string   // SRV record (e.g. _ovo._tcp.ovo.example.com) giving the addresses and the ports of the seeds
+	Period  Duration // re-resolution period, ClusterCheckPeriod if not set
+}
+
+// Check if the discovery is configured.
+func (d SeedDiscovery) enabled() bool {
+	return d.Name != "" || d.Service != ""
+}
+
+// Check that the discovery has a port for the addresses of Name.
+func (d SeedDiscovery) validate() error {
+	if d.Name != "" {
+		if port, err := strconv.Atoi(d.Port); err != nil || port <= 0 || port > 65535 {
+			return errors.New("Invalid configuration: invalid seed discovery port " + strconv.Quote(d.Port) + ".")
+		}
+	}
+	if d.Period < 0 {
+		return errors.New("Invalid configuration: negative seed discovery period.")
+	}
+	return nil
+}
+
+// Get the resolver of the client.
+func (c *Client) resolver() Resolver {
+	if resolver := c.getConfig().Resolver; resolver != nil {
+		return resolver
+	}
+	return net.DefaultResolver
+}
+
+// Resolve the seed nodes; the previous seeds are kept if the resolution fails.
+func (c *Client) discoverSeeds() {
+	d := c.getConfig().SeedDiscovery
+	if !d.enabled() {
+		c.seedMux.Lock()
+		c.discovered = nil
+		c.seedMux.Unlock()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+	nodes := make([]Node, 0)
+	if d.Name != "" {
+		addrs, err := c.resolver().LookupHost(ctx, d.Name)
+		if err != nil {
+			c.logf("Resolution of %s failed due to %v.\r\n", d.Name, err)
+		}
+		for _, addr := range addrs {
+			nodes = append(nodes, Node{Host: addr, Port: d.Port})
+		}
+	}
+	if d.Service != "" {
+		_, records, err := c.resolver().LookupSRV(ctx, "", "", d.Service)
+		if err != nil {
+			c.logf("Resolution of %s failed due to %v.\r\n", d.Service, err)
+		}
+		for _, srv := range records {
+			nodes = append(nodes, Node{Host: strings.TrimSuffix(srv.Target, "."), Port: strconv.Itoa(int(srv.Port))})
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	c.seedMux.Lock()
+	c.discovered = nodes
+	c.seedMux.Unlock()
+}
+
+// Get the seed nodes: the configured nodes and the discovered ones.
+func (c *Client) seeds() []Node {
+	c.seedMux.Lock()
+	defer c.seedMux.Unlock()
+	nodes := c.getConfig().ClusterNodes
+	seeds := make([]Node, 0, len(nodes)+len(c.discovered))
+	seeds = append(seeds, nodes...)
+	return append(seeds, c.discovered...)
+}
+
+// Get the re-resolution period of the seed nodes.
+func (c *Client) discoveryPeriod() time.Duration {
+	config := c.getConfig()
+	if config.SeedDiscovery.Period > 0 {
+		return time.Duration(config.SeedDiscovery.Period)
+	}
+	return time.Duration(config.ClusterCheckPeriod)
+}
+
+// Resolve the seed nodes periodically, if the discovery is configured.
+func (c *Client) discover() {
+	period := c.discoveryPeriod()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.discoverSeeds()
+			// the period can be changed by a configuration reload
+			if p := c.discoveryPeriod(); p != period {
+				period = p
+				ticker.Reset(period)
+			}
+		case <-c.doneChan:
+			return
+		}
+	}
+}
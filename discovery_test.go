@@ -0,0 +1,90 @@
+package ovoclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// A resolver answering with fixed records.
+type fakeResolver struct {
+	mux   sync.Mutex
+	hosts map[string][]string
+	srv   map[string][]*net.SRV
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if addrs, ok := r.hosts[host]; ok {
+		return addrs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if records, ok := r.srv[name]; ok {
+		return name, records, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func TestSeedDiscoveryHost(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	resolver := &fakeResolver{hosts: map[string][]string{"ovo.example.com": {"127.0.0.1"}}}
+	port := strconv.Itoa(fc.nodes[0].node.Port)
+	c, err := New(WithSeedDiscovery(SeedDiscovery{Name: "ovo.example.com", Port: port}), WithResolver(resolver), WithStartupMode(StartupFailFast))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Put("key", "value", 0); err != nil {
+		t.Error(err)
+	}
+	// the seeds change on every deploy
+	resolver.mux.Lock()
+	resolver.hosts["ovo.example.com"] = []string{"127.0.0.2", "127.0.0.3"}
+	resolver.mux.Unlock()
+	c.discoverSeeds()
+	if seeds := c.seeds(); len(seeds) != 2 || seeds[0].Host != "127.0.0.2" || seeds[1].Port != port {
+		t.Errorf("unexpected seeds %v", seeds)
+	}
+	// a failed resolution keeps the previous seeds
+	resolver.mux.Lock()
+	delete(resolver.hosts, "ovo.example.com")
+	resolver.mux.Unlock()
+	c.discoverSeeds()
+	if seeds := c.seeds(); len(seeds) != 2 {
+		t.Errorf("unexpected seeds %v", seeds)
+	}
+}
+
+func TestSeedDiscoverySRV(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	resolver := &fakeResolver{srv: map[string][]*net.SRV{"_ovo._tcp.example.com": {{Target: "127.0.0.1.", Port: uint16(fc.nodes[1].node.Port)}}}}
+	config := &Configuration{SeedDiscovery: SeedDiscovery{Service: "_ovo._tcp.example.com"}, Resolver: resolver, StartupMode: StartupFailFast}
+	c, err := NewClientFromConfigE(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if seeds := c.seeds(); len(seeds) != 1 || seeds[0].Host != "127.0.0.1" {
+		t.Errorf("unexpected seeds %v", seeds)
+	}
+}
+
+func TestSeedDiscoveryValidation(t *testing.T) {
+	config := &Configuration{SeedDiscovery: SeedDiscovery{Name: "ovo.example.com"}}
+	if err := config.Validate(); err == nil {
+		t.Error("discovery without port accepted")
+	}
+	config.SeedDiscovery.Port = "5050"
+	if err := config.Validate(); err != nil {
+		t.Error(err)
+	}
+}
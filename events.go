@@ -0,0 +1,54 @@
+package ovoclient
+
+import (
+	"fmt"
+	"time"
+)
+
+// Type of a client event.
+type EventType int
+
+const (
+	// The topology read from the cluster is not valid; Err is a *TopologyError.
+	EventInvalidTopology EventType = iota
+	// The configuration file was reloaded.
+	EventConfigReloaded
+	// The configuration file was changed but it is not valid; Err is the validation error.
+	EventConfigRejected
+	// The cluster changed the state of a node; State is the new state (ACTIVE or INACTIVE).
+	EventNodeStateChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventInvalidTopology:
+		return "invalid-topology"
+	case EventConfigReloaded:
+		return "config-reloaded"
+	case EventConfigRejected:
+		return "config-rejected"
+	case EventNodeStateChanged:
+		return "node-state-changed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// An Event notifies a change or a problem detected by the client.
+type Event struct {
+	Type  EventType
+	Time  time.Time
+	Node  string // name of the node, if the event refers to a node
+	State string // state of the node of EventNodeStateChanged
+	Err   error
+}
+
+// Send an event to the configured handler.
+// The handler is called synchronously and must not block.
+func (c *Client) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if handler := c.getConfig().EventHandler; handler != nil {
+		handler(e)
+	}
+}
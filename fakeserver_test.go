@@ -0,0 +1,315 @@
+package ovoclient
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// In memory OVO node used by the unit tests.
+type fakeNode struct {
+	mux      sync.Mutex
+	server   *httptest.Server
+	node     *model.OvoTopologyNode
+	cluster  *fakeCluster
+	data     map[string][]byte
+	counters map[string]int64
+	ttls     map[string]int // time to live of the keys and, prefixed by #, of the counters
+	down     bool           // close the connections without answering
+	status   int            // if not zero every request is answered with this status
+	code     string         // OVO error code of the answers with status
+	delay    time.Duration  // wait before answering
+	requests int
+	opened   int // connections opened by the clients
+	closed   int // connections closed
+}
+
+// Cluster of in memory OVO nodes; every node is the twin of the next one.
+type fakeCluster struct {
+	nodes    []*fakeNode
+	topology model.OvoTopology
+}
+
+func newFakeCluster(t *testing.T, size int) *fakeCluster {
+	fc := &fakeCluster{}
+	for i := 0; i < size; i++ {
+		fn := &fakeNode{cluster: fc, data: make(map[string][]byte), counters: make(map[string]int64), ttls: make(map[string]int)}
+		fn.server = httptest.NewUnstartedServer(fn)
+		fn.server.Config.ConnState = fn.countConn
+		fn.server.Start()
+		addr := fn.server.Listener.Addr().(*net.TCPAddr)
+		fn.node = &model.OvoTopologyNode{Name: "node" + strconv.Itoa(i), Host: "127.0.0.1", Port: addr.Port, State: model.Active, HashRange: make([]int, 0)}
+		fc.nodes = append(fc.nodes, fn)
+		fc.topology.Nodes = append(fc.topology.Nodes, fn.node)
+	}
+	for hash := 0; hash < model.MaxNodeNumber; hash++ {
+		nd := fc.nodes[hash%size].node
+		nd.HashRange = append(nd.HashRange, hash)
+	}
+	if size > 1 {
+		for i, fn := range fc.nodes {
+			fn.node.Twins = []string{fc.nodes[(i+1)%size].node.Name}
+		}
+	}
+	t.Cleanup(fc.close)
+	return fc
+}
+
+// Make every node the twin of the next n nodes.
+func (fc *fakeCluster) setTwins(n int) {
+	for i, fn := range fc.nodes {
+		fn.node.Twins = make([]string, 0, n)
+		for j := 1; j <= n; j++ {
+			fn.node.Twins = append(fn.node.Twins, fc.nodes[(i+j)%len(fc.nodes)].node.Name)
+		}
+	}
+}
+
+// Get a configuration pointing to the first node of the cluster.
+func (fc *fakeCluster) config() *Configuration {
+	return &Configuration{ClusterNodes: []Node{{Host: "127.0.0.1", Port: strconv.Itoa(fc.nodes[0].node.Port)}}}
+}
+
+// Get the node owning the hash slot of the key.
+func (fc *fakeCluster) owner(key string) *fakeNode {
+	hash := int(GetPositiveHashCode(key, model.MaxNodeNumber))
+	for _, fn := range fc.nodes {
+		for _, h := range fn.node.HashRange {
+			if h == hash {
+				return fn
+			}
+		}
+	}
+	return nil
+}
+
+// Get the node by name.
+func (fc *fakeCluster) node(name string) *fakeNode {
+	for _, fn := range fc.nodes {
+		if fn.node.Name == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+func (fc *fakeCluster) close() {
+	for _, fn := range fc.nodes {
+		fn.server.CloseClientConnections()
+		fn.server.Close()
+	}
+}
+
+func (fn *fakeNode) setDown(down bool) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.down = down
+}
+
+func (fn *fakeNode) setStatus(status int) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.status = status
+}
+
+func (fn *fakeNode) setError(status int, code string) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.status = status
+	fn.code = code
+}
+
+func (fn *fakeNode) setDelay(delay time.Duration) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.delay = delay
+}
+
+// Set the state of the node; the topology is shared by all the nodes, so all of them are locked.
+func (fn *fakeNode) setState(state string) {
+	for _, n := range fn.cluster.nodes {
+		n.mux.Lock()
+		defer n.mux.Unlock()
+	}
+	fn.node.State = state
+}
+
+func (fn *fakeNode) value(key string) ([]byte, bool) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	data, ok := fn.data[key]
+	return data, ok
+}
+
+func (fn *fakeNode) counter(key string) int64 {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	return fn.counters[key]
+}
+
+func (fn *fakeNode) ttl(key string) int {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	return fn.ttls[key]
+}
+
+func (fn *fakeNode) store(key string, data []byte) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	fn.data[key] = data
+}
+
+func (fn *fakeNode) countConn(conn net.Conn, state http.ConnState) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	switch state {
+	case http.StateNew:
+		fn.opened++
+	case http.StateClosed, http.StateHijacked:
+		fn.closed++
+	}
+}
+
+// Get the number of connections opened and closed.
+func (fn *fakeNode) connCount() (int, int) {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	return fn.opened, fn.closed
+}
+
+func (fn *fakeNode) requestCount() int {
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	return fn.requests
+}
+
+func (fn *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fn.mux.Lock()
+	fn.requests++
+	down, status, code, delay := fn.down, fn.status, fn.code, fn.delay
+	fn.mux.Unlock()
+	if down {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if status != 0 && code != "" {
+		reply(w, status, &model.OvoResponse{Status: "error", Code: code})
+		return
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	fn.mux.Lock()
+	defer fn.mux.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/ovo/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "cluster":
+		reply(w, 200, &model.OvoResponseTopology{Status: "done", Data: fn.cluster.topology})
+	case path == "cluster/me":
+		reply(w, 200, &model.OvoResponseTopologyNode{Status: "done", Data: *fn.node})
+	case path == "keys":
+		keys := make([]string, 0, len(fn.data))
+		for k := range fn.data {
+			keys = append(keys, k)
+		}
+		reply(w, 200, &model.OvoResponse{Status: "done", Data: &model.OvoKVKeys{Keys: keys}})
+	case path == "keystorage" && r.Method == "GET":
+		reply(w, 200, &model.OvoResponse{Status: "done", Data: int64(len(fn.data))})
+	case path == "keystorage":
+		req := &model.OvoKVRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		fn.data[req.Key] = req.Data
+		fn.ttls[req.Key] = req.TTL
+		reply(w, 200, &model.OvoResponse{Status: "done"})
+	case parts[0] == "keystorage" && len(parts) == 2:
+		data, ok := fn.data[parts[1]]
+		if !ok {
+			reply(w, 404, &model.OvoResponse{Status: "error", Code: "101"})
+			return
+		}
+		if r.Method == "DELETE" {
+			delete(fn.data, parts[1])
+			reply(w, 200, &model.OvoResponse{Status: "done"})
+			return
+		}
+		reply(w, 200, &model.OvoResponse{Status: "done", Data: &model.OvoKVResponse{Key: parts[1], Data: data, TTL: fn.ttls[parts[1]]}})
+	case parts[0] == "keystorage" && len(parts) == 3:
+		fn.serveConditional(w, r, parts[1], parts[2])
+	case path == "counters":
+		req := &model.OvoCounter{}
+		json.NewDecoder(r.Body).Decode(req)
+		if r.Method == "PUT" {
+			fn.counters[req.Key] += req.Value
+		} else {
+			fn.counters[req.Key] = req.Value
+		}
+		fn.ttls["#"+req.Key] = req.TTL
+		reply(w, 200, &model.OvoCounterResponse{Status: "done", Data: model.OvoCounter{Key: req.Key, Value: fn.counters[req.Key], TTL: req.TTL}})
+	case parts[0] == "counters" && len(parts) == 2:
+		value, ok := fn.counters[parts[1]]
+		if !ok {
+			reply(w, 404, &model.OvoCounterResponse{Status: "error", Code: "101"})
+			return
+		}
+		if r.Method == "DELETE" {
+			delete(fn.counters, parts[1])
+		}
+		reply(w, 200, &model.OvoCounterResponse{Status: "done", Data: model.OvoCounter{Key: parts[1], Value: value, TTL: fn.ttls["#"+parts[1]]}})
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+// Serve getandremove, updatevalueifequal and deletevalueifequal.
+func (fn *fakeNode) serveConditional(w http.ResponseWriter, r *http.Request, key string, op string) {
+	data, ok := fn.data[key]
+	if !ok {
+		reply(w, 404, &model.OvoResponse{Status: "error", Code: "101"})
+		return
+	}
+	switch op {
+	case "getandremove":
+		delete(fn.data, key)
+		reply(w, 200, &model.OvoResponse{Status: "done", Data: &model.OvoKVResponse{Key: key, Data: data}})
+	case "updatevalueifequal", "deletevalueifequal":
+		req := &model.OvoKVUpdateRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		if string(req.Data) != string(data) {
+			reply(w, 403, &model.OvoResponse{Status: "error", Code: "102"})
+			return
+		}
+		if op == "updatevalueifequal" {
+			fn.data[key] = req.NewData
+		} else {
+			delete(fn.data, key)
+		}
+		reply(w, 200, &model.OvoResponse{Status: "done"})
+	default:
+		w.WriteHeader(400)
+	}
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,287 @@
+package ovoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+const (
+	defaultHealthCheckPeriod = Duration(5 * time.Second)
+	maxProbeFailures         = 2
+)
+
+// Health status of a OVO node as seen by the background prober.
+type NodeHealth struct {
+	Name      string
+	Host      string
+	Port      int
+	State     string        // state reported by the node (ACTIVE or INACTIVE)
+	Alive     bool          // false when the last probes failed
+	Latency   time.Duration // round trip time of the last successful probe
+	LastProbe time.Time
+	LastError string
+	Failures  int // number of consecutive failed probes and operations
+}
+
+// Health report of the OVO cluster.
+type HealthReport struct {
+	Ready          bool // true if every hash slot is served by at least one alive and active node
+	Nodes          []NodeHealth
+	UncoveredSlots []int32 // hash slots without an alive and active node
+}
+
+// Health tracker keeps the last known status of every node.
+type healthTracker struct {
+	mux   sync.RWMutex
+	nodes map[string]*NodeHealth
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{nodes: make(map[string]*NodeHealth)}
+}
+
+// Check if the node is alive; nodes that were never probed are considered alive.
+func (h *healthTracker) isAlive(name string) bool {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	if nh, ok := h.nodes[name]; ok {
+		return nh.Alive
+	}
+	return true
+}
+
+// Check if the node is alive and not marked as inactive by the cluster.
+func (h *healthTracker) isServing(name string) bool {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	if nh, ok := h.nodes[name]; ok {
+		return nh.Alive && nh.State != model.Inactive
+	}
+	return true
+}
+
+// Record the result of a probe.
+func (h *healthTracker) record(node *model.OvoTopologyNode, latency time.Duration, err error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	nh, ok := h.nodes[node.Name]
+	if !ok {
+		nh = &NodeHealth{Name: node.Name, Alive: true, State: node.State}
+		h.nodes[node.Name] = nh
+	}
+	nh.Host = node.Host
+	nh.Port = node.Port
+	nh.LastProbe = time.Now()
+	if err != nil {
+		nh.Failures++
+		nh.LastError = err.Error()
+		if nh.Failures >= maxProbeFailures {
+			nh.Alive = false
+		}
+		return
+	}
+	nh.Failures = 0
+	nh.LastError = ""
+	nh.Alive = true
+	nh.Latency = latency
+}
+
+// Record a failure of an operation sent to the node; like the failed probes, the consecutive failures mark the node as not alive until the next successful probe.
+func (h *healthTracker) failure(node *model.OvoTopologyNode, err error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	nh, ok := h.nodes[node.Name]
+	if !ok {
+		nh = &NodeHealth{Name: node.Name, Host: node.Host, Port: node.Port, Alive: true, State: node.State}
+		h.nodes[node.Name] = nh
+	}
+	nh.Failures++
+	nh.LastError = err.Error()
+	if nh.Failures >= maxProbeFailures {
+		nh.Alive = false
+	}
+}
+
+// Set the state of the node reported by the cluster; it returns true if the known state changed.
+func (h *healthTracker) setState(node *model.OvoTopologyNode, state string) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	nh, ok := h.nodes[node.Name]
+	if !ok {
+		h.nodes[node.Name] = &NodeHealth{Name: node.Name, Host: node.Host, Port: node.Port, Alive: true, State: state}
+		return false
+	}
+	previous := nh.State
+	nh.State = state
+	// the first state of a node is not a transition
+	return previous != "" && previous != state
+}
+
+// Check if the node is not marked as inactive by the cluster.
+func (h *healthTracker) isActive(name string) bool {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	if nh, ok := h.nodes[name]; ok {
+		return nh.State != model.Inactive
+	}
+	return true
+}
+
+// Remove the nodes that are not in the topology anymore.
+func (h *healthTracker) retain(nodes []*model.OvoTopologyNode) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	names := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		names[node.Name] = true
+	}
+	for name := range h.nodes {
+		if !names[name] {
+			delete(h.nodes, name)
+		}
+	}
+}
+
+// Get a copy of the node status; unknown nodes are reported as alive.
+func (h *healthTracker) get(node *model.OvoTopologyNode) NodeHealth {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+	if nh, ok := h.nodes[node.Name]; ok {
+		return *nh
+	}
+	return NodeHealth{Name: node.Name, Host: node.Host, Port: node.Port, State: node.State, Alive: true}
+}
+
+// Probe the cluster nodes periodically.
+func (c *Client) probe() {
+	period := time.Duration(c.getConfig().HealthCheckPeriod)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), period)
+		c.probeNodes(ctx)
+		cancel()
+		// the period can be changed by a configuration reload
+		if p := time.Duration(c.getConfig().HealthCheckPeriod); p != period {
+			period = p
+			ticker.Reset(period)
+		}
+		select {
+		case <-ticker.C:
+		case <-c.doneChan:
+			return
+		}
+	}
+}
+
+// Probe all the nodes of the topology concurrently.
+func (c *Client) probeNodes(ctx context.Context) {
+	t := c.routes()
+	if t.topology == nil {
+		return
+	}
+	nodes := t.topology.Nodes
+	sessions := make([]*Session, 0, len(nodes))
+	for _, node := range nodes {
+		if s, ok := t.sessions[node.Name]; ok {
+			sessions = append(sessions, s)
+		}
+	}
+	c.health.retain(nodes)
+	var wg sync.WaitGroup
+	for _, s := range sessions {
+		wg.Add(1)
+		go func(s *Session) {
+			defer wg.Done()
+			c.probeNode(ctx, s)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// Probe a node reading its own topology entry.
+func (c *Client) probeNode(ctx context.Context, s *Session) {
+	res := &model.OvoResponseTopologyNode{}
+	start := time.Now()
+	rs, err := s.Send(&Request{Method: "GET", Url: createTopologyNodeEndpoint(s.Node().Host, s.port), Result: res, Context: ctx})
+	if err == nil && rs.Status() != 200 {
+		err = errors.New("Unexpected status " + strconv.Itoa(rs.Status()) + ".")
+	}
+	if err != nil {
+		c.logf("Probe of node %s failed due to %v.\r\n", s.Node().Name, err)
+	}
+	latency := time.Since(start)
+	c.health.record(s.Node(), latency, err)
+	if err == nil {
+		c.latency.observe(s.Node().Name, latency)
+		c.observeState(s.Node(), res.Data.State)
+		c.replayHints(s)
+	}
+}
+
+// Get the health report of the cluster nodes.
+func (c *Client) Health() HealthReport {
+	report := HealthReport{Nodes: make([]NodeHealth, 0), UncoveredSlots: make([]int32, 0)}
+	t := c.routes()
+	if t.topology == nil {
+		return report
+	}
+	for _, node := range t.topology.Nodes {
+		report.Nodes = append(report.Nodes, c.health.get(node))
+	}
+	sort.Sort(byNodeName(report.Nodes))
+	for hash, s := range t.slots {
+		if s == nil || !c.isSlotServed(t, s) {
+			report.UncoveredSlots = append(report.UncoveredSlots, int32(hash))
+		}
+	}
+	report.Ready = len(report.Nodes) > 0 && len(report.UncoveredSlots) == 0
+	return report
+}
+
+// Check if the primary node or one of its twins can serve the requests.
+func (c *Client) isSlotServed(t *routingTable, s *Session) bool {
+	if c.health.isServing(s.Node().Name) {
+		return true
+	}
+	for _, st := range t.twinSessions(s) {
+		if c.health.isServing(st.Node().Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Probe all the cluster nodes and check if the cluster is ready to serve requests.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.end()
+	c.probeNodes(ctx)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	report := c.Health()
+	if len(report.Nodes) == 0 {
+		return ErrNoTopology
+	}
+	if !report.Ready {
+		return fmt.Errorf("Cluster not ready: %d hash slots are not served.", len(report.UncoveredSlots))
+	}
+	return nil
+}
+
+// Sort node status by name.
+type byNodeName []NodeHealth
+
+func (a byNodeName) Len() int           { return len(a) }
+func (a byNodeName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byNodeName) Less(i, j int) bool { return a[i].Name < a[j].Name }
@@ -0,0 +1,80 @@
+package ovoclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPingAndHealth(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	report := c.Health()
+	if !report.Ready || len(report.Nodes) != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for _, nh := range report.Nodes {
+		if !nh.Alive || nh.State != "ACTIVE" || nh.LastProbe.IsZero() {
+			t.Errorf("unexpected node health %+v", nh)
+		}
+	}
+}
+
+func TestHealthNotReady(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	// a single node down is covered by its twin
+	fc.nodes[1].setDown(true)
+	for i := 0; i < maxProbeFailures; i++ {
+		c.Ping(context.Background())
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	// two adjacent nodes down leave some hash slots uncovered
+	fc.nodes[2].setDown(true)
+	for i := 0; i < maxProbeFailures; i++ {
+		c.Ping(context.Background())
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Fatal("Ping should fail")
+	}
+	report := c.Health()
+	if report.Ready || len(report.UncoveredSlots) == 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestRoutingSkipsDeadPrimary(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("skipme")
+	twin := fc.node(owner.node.Twins[0])
+	twin.store("skipme", []byte(`"twin"`))
+	owner.setDown(true)
+	for i := 0; i < maxProbeFailures; i++ {
+		c.Ping(context.Background())
+	}
+	before := owner.requestCount()
+	var value string
+	if err := c.Get("skipme", &value); err != nil || value != "twin" {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	if err := c.Put("skipme", "new", 0); !IsDurable(err) {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if data, _ := twin.value("skipme"); string(data) != `"new"` {
+		t.Errorf("twin not updated: %s", data)
+	}
+	// only the topology refresh can reach the dead primary
+	time.Sleep(10 * time.Millisecond)
+	if owner.requestCount()-before > 2 {
+		t.Errorf("dead primary received %d requests", owner.requestCount()-before)
+	}
+}
@@ -0,0 +1,131 @@
+package ovoclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHedgeDelay  = Duration(100 * time.Millisecond) // delay used until the node latency is learned
+	defaultHedgeBudget = 0.1
+	maxHedgeTokens     = 10
+)
+
+// Hedging policy of the reads: when the primary node does not answer within the delay
+// the read is sent also to a twin and the first successful answer is used.
+type HedgePolicy struct {
+	Enabled  bool
+	Delay    Duration // static delay; if zero the delay is the 95th percentile of the primary latency
+	MinDelay Duration // lower bound of the learned delay
+	Budget   float64  // maximum fraction of the reads that can be hedged, 0.1 if not set
+}
+
+// The hedge budget allows a hedged read every 1/budget reads, with bursts of maxHedgeTokens reads.
+type hedgeBudget struct {
+	mux    sync.Mutex
+	tokens float64
+}
+
+func newHedgeBudget() *hedgeBudget {
+	return &hedgeBudget{tokens: maxHedgeTokens}
+}
+
+// Add the budget of a read.
+func (b *hedgeBudget) deposit(budget float64) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.tokens += budget; b.tokens > maxHedgeTokens {
+		b.tokens = maxHedgeTokens
+	}
+}
+
+// Take the budget of a hedged read; false if the budget is exhausted.
+func (b *hedgeBudget) withdraw() bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Get the delay before hedging a read sent to the node.
+func (c *Client) hedgeDelay(s *Session) time.Duration {
+	policy := c.getConfig().Hedge
+	if policy.Delay > 0 {
+		return time.Duration(policy.Delay)
+	}
+	delay, ok := c.latency.p95(s.Node().Name)
+	if !ok {
+		delay = time.Duration(defaultHedgeDelay)
+	}
+	if delay < time.Duration(policy.MinDelay) {
+		delay = time.Duration(policy.MinDelay)
+	}
+	return delay
+}
+
+// Send a read to the primary node and, if it does not answer within the hedge delay, to the first alive and active twin.
+// The primary answer is accepted as it is, the twin answer only if successful; the slower request is canceled.
+func (c *Client) hedgedRead(ctx context.Context, s *Session, twins []*Session, op nodeOp) (*Response, error) {
+	type result struct {
+		session *Session
+		rs      *Response
+		err     error
+	}
+	budget := c.getConfig().Hedge.Budget
+	if budget <= 0 {
+		budget = defaultHedgeBudget
+	}
+	c.hedges.deposit(budget)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, 2)
+	send := func(st *Session) {
+		rs, err := c.timedOp(ctx, st, op)
+		results <- result{session: st, rs: rs, err: err}
+	}
+	go send(s)
+	timer := time.NewTimer(c.hedgeDelay(s))
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.rs, r.err
+	case <-timer.C:
+	}
+	var twin *Session
+	for _, st := range twins {
+		if c.health.isServing(st.Node().Name) {
+			twin = st
+			break
+		}
+	}
+	if twin == nil {
+		r := <-results
+		return r.rs, r.err
+	}
+	if !c.hedges.withdraw() {
+		atomic.AddUint64(&c.metrics.hedgeBudgetExhausted, 1)
+		r := <-results
+		return r.rs, r.err
+	}
+	atomic.AddUint64(&c.metrics.hedgedReads, 1)
+	go send(twin)
+	var err error
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.session == s {
+			if r.err == nil {
+				return r.rs, nil
+			}
+			err = r.err
+		} else if r.err == nil && r.rs.status == 200 {
+			atomic.AddUint64(&c.metrics.hedgeWins, 1)
+			return r.rs, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,56 @@
+package ovoclient
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHedgedRead(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.Hedge = HedgePolicy{Enabled: true, Delay: Duration(5 * time.Millisecond), Budget: 0.01}
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("hedge")
+	twin := fc.node(owner.node.Twins[0])
+	owner.store("hedge", []byte(`"primary"`))
+	twin.store("hedge", []byte(`"twin"`))
+	owner.setDelay(100 * time.Millisecond)
+	start := time.Now()
+	var value string
+	if err := c.Get("hedge", &value); err != nil || value != "twin" {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Errorf("hedged read took %v", elapsed)
+	}
+	if m := c.Metrics(); m.HedgedReads != 1 || m.HedgeWins != 1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	// the budget allows a burst of maxHedgeTokens hedged reads
+	for i := 0; i < maxHedgeTokens; i++ {
+		c.Get("hedge", &value)
+	}
+	if m := c.Metrics(); m.HedgedReads != maxHedgeTokens || m.HedgeBudgetExhausted != 1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	if value != "primary" {
+		t.Errorf("read not hedged should be answered by the primary: %q", value)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	lt := newLatencyTracker()
+	for i := 1; i < minLatencySamples; i++ {
+		lt.record("node", time.Duration(i)*time.Millisecond)
+	}
+	if _, ok := lt.p95("node"); ok {
+		t.Error("percentile computed without enough samples")
+	}
+	for i := 0; i < 2*latencySamples; i++ {
+		lt.record("node", time.Duration(i%100)*time.Millisecond)
+	}
+	if p95, ok := lt.p95("node"); !ok || p95 < 90*time.Millisecond || p95 > 99*time.Millisecond {
+		t.Errorf("unexpected percentile %v", p95)
+	}
+}
@@ -0,0 +1,550 @@
+package ovoclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+const (
+	defaultMaxHints   = 10000
+	defaultMaxHintAge = Duration(3 * time.Hour)
+	hintFileExt       = ".hints"
+	hintSpoolDelay    = 100 * time.Millisecond // minimum interval between the writes of the spool files
+	hintExpiryPeriod  = time.Minute            // period of the check of the expired hints
+)
+
+// Operations of the hints.
+const (
+	hintPut           = "put"
+	hintDelete        = "delete"
+	hintUpdate        = "update"
+	hintSetCounter    = "set-counter"
+	hintDeleteCounter = "delete-counter"
+)
+
+// Hinted handoff of the writes missed by a node: the writes acknowledged only by the twins are recorded
+// and replayed on the node when it is alive again.
+type HintedHandoff struct {
+	Enabled  bool
+	Dir      string   // directory where the hints are spooled, read at startup; the hints are kept only in memory if not set
+	MaxHints int      // maximum number of hints, 10000 if not set; the oldest hints are dropped
+	MaxAge   Duration // maximum age of the hints, 3 hours if not set; the older hints are discarded
+}
+
+// A Hint is a write missed by a node.
+type Hint struct {
+	Node    string
+	Op      string // put, delete, update, set-counter or delete-counter
+	Key     string
+	Data    []byte `json:",omitempty"`
+	Old     []byte `json:",omitempty"` // value replaced by a conditional update
+	Value   int64  `json:",omitempty"`
+	TTL     int    `json:",omitempty"` // time to live in seconds when the write was done
+	Created time.Time
+}
+
+// A mutation gets the hint of a write from the response of a replica that acknowledged it; nil if the write must not be replayed.
+type mutation func(rs *Response) *Hint
+
+// Get the mutation of a write of an object.
+func putMutation(key string, data []byte, ttl int) mutation {
+	return func(rs *Response) *Hint {
+		return &Hint{Op: hintPut, Key: key, Data: data, TTL: ttl}
+	}
+}
+
+// Get the mutation of a conditional update of an object; it is replayed only if it was accepted.
+func updateMutation(key string, oldData []byte, newData []byte) mutation {
+	return func(rs *Response) *Hint {
+		if rs.status != 200 {
+			return nil
+		}
+		return &Hint{Op: hintUpdate, Key: key, Data: newData, Old: oldData}
+	}
+}
+
+// Get the mutation of a delete of an object; the conditional deletes are replayed only if they were accepted.
+func deleteMutation(key string) mutation {
+	return func(rs *Response) *Hint {
+		if rs.status != 200 && rs.status != 404 {
+			return nil
+		}
+		return &Hint{Op: hintDelete, Key: key}
+	}
+}
+
+// Get the mutation of a write of a counter; the value written by the replica is replayed, so the increments are not applied twice.
+func counterMutation(key string, ttl int) mutation {
+	return func(rs *Response) *Hint {
+		if rs.status != 200 {
+			return nil
+		}
+		return &Hint{Op: hintSetCounter, Key: key, Value: counterValue(rs), TTL: ttl}
+	}
+}
+
+// Get the mutation of a delete of a counter.
+func deleteCounterMutation(key string) mutation {
+	return func(rs *Response) *Hint {
+		return &Hint{Op: hintDeleteCounter, Key: key}
+	}
+}
+
+// Check if the hint is older than maxAge or if the time to live of the value elapsed; a value whose time to live elapsed is not written again.
+func (h *Hint) expired(now time.Time, maxAge time.Duration) bool {
+	age := now.Sub(h.Created)
+	return age > maxAge || (h.Op == hintPut || h.Op == hintSetCounter) && h.TTL > 0 && age >= time.Duration(h.TTL)*time.Second
+}
+
+// Check if two hints refer to the same object: the newer hint replaces the older.
+func (h *Hint) sameObject(o *Hint) bool {
+	counter := h.Op == hintSetCounter || h.Op == hintDeleteCounter
+	ocounter := o.Op == hintSetCounter || o.Op == hintDeleteCounter
+	return h.Key == o.Key && counter == ocounter
+}
+
+// Store of the pending hints by node, oldest first.
+type hintStore struct {
+	mux       sync.Mutex
+	nodes     map[string][]*Hint
+	count     int
+	replaying map[string]bool
+	dirty     map[string]bool  // nodes whose hints must be spooled
+	changed   chan bool        // signals the dirty nodes to the spooler
+	spool     sync.Mutex       // serializes the writes of the spool files
+	now       func() time.Time // clock of the hints
+}
+
+func newHintStore() *hintStore {
+	return &hintStore{nodes: make(map[string][]*Hint), replaying: make(map[string]bool), dirty: make(map[string]bool),
+		changed: make(chan bool, 1), now: time.Now}
+}
+
+// Add a hint replacing the hint of the same object; it returns the nodes whose hints changed and the number of dropped hints.
+func (hs *hintStore) add(h *Hint, max int) ([]string, int) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	hs.remove(h)
+	hs.nodes[h.Node] = append(hs.nodes[h.Node], h)
+	hs.count++
+	changed := []string{h.Node}
+	dropped := 0
+	for hs.count > max {
+		// drop the oldest hint
+		oldest := ""
+		for name, hints := range hs.nodes {
+			if len(hints) > 0 && (oldest == "" || hints[0].Created.Before(hs.nodes[oldest][0].Created)) {
+				oldest = name
+			}
+		}
+		hs.nodes[oldest] = hs.nodes[oldest][1:]
+		hs.count--
+		dropped++
+		if oldest != h.Node {
+			changed = append(changed, oldest)
+		}
+	}
+	return changed, dropped
+}
+
+// Remove the hint of the same object of h; it returns true if a hint was removed.
+func (hs *hintStore) remove(h *Hint) bool {
+	hints := hs.nodes[h.Node]
+	for i, o := range hints {
+		if o.sameObject(h) {
+			hs.nodes[h.Node] = append(hints[:i:i], hints[i+1:]...)
+			hs.count--
+			return true
+		}
+	}
+	return false
+}
+
+// Remove the hint of the same object of h, superseded by a newer write.
+func (hs *hintStore) supersede(h *Hint) bool {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	return hs.remove(h)
+}
+
+// Get a copy of the pending hints of the node.
+func (hs *hintStore) pending(node string) []*Hint {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	return append([]*Hint(nil), hs.nodes[node]...)
+}
+
+// Check if the hint is still pending, i.e. it was not superseded by a newer write.
+func (hs *hintStore) isPending(h *Hint) bool {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	for _, o := range hs.nodes[h.Node] {
+		if o == h {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove a hint replayed or expired; a newer hint of the same object is kept.
+func (hs *hintStore) done(h *Hint) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	hints := hs.nodes[h.Node]
+	for i, o := range hints {
+		if o == h {
+			hs.nodes[h.Node] = append(hints[:i:i], hints[i+1:]...)
+			hs.count--
+			return
+		}
+	}
+}
+
+// Remove the hints that expired; it returns the nodes whose hints changed and the number of expired hints.
+func (hs *hintStore) expire(now time.Time, maxAge time.Duration) ([]string, int) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	changed := make([]string, 0)
+	expired := 0
+	for name, hints := range hs.nodes {
+		kept := hints[:0:0]
+		for _, h := range hints {
+			if !h.expired(now, maxAge) {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) < len(hints) {
+			hs.nodes[name] = kept
+			hs.count -= len(hints) - len(kept)
+			expired += len(hints) - len(kept)
+			changed = append(changed, name)
+		}
+	}
+	return changed, expired
+}
+
+// Remove the hints of the nodes that are not in the topology anymore; it returns the nodes and the number of removed hints.
+func (hs *hintStore) retain(nodes []*model.OvoTopologyNode) ([]string, int) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	names := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		names[node.Name] = true
+	}
+	removed := make([]string, 0)
+	dropped := 0
+	for name, hints := range hs.nodes {
+		if !names[name] {
+			delete(hs.nodes, name)
+			hs.count -= len(hints)
+			dropped += len(hints)
+			removed = append(removed, name)
+		}
+	}
+	return removed, dropped
+}
+
+// Mark the hints of the nodes as changed, so that they are spooled in background.
+func (hs *hintStore) markDirty(nodes ...string) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	for _, node := range nodes {
+		hs.dirty[node] = true
+	}
+	select {
+	case hs.changed <- true:
+	default:
+	}
+}
+
+// Get and clear the nodes whose hints changed.
+func (hs *hintStore) takeDirty() []string {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	nodes := make([]string, 0, len(hs.dirty))
+	for node := range hs.dirty {
+		nodes = append(nodes, node)
+	}
+	hs.dirty = make(map[string]bool)
+	return nodes
+}
+
+// Mark the replay of the node as started; false if it is already running.
+func (hs *hintStore) startReplay(node string) bool {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	if hs.replaying[node] || len(hs.nodes[node]) == 0 {
+		return false
+	}
+	hs.replaying[node] = true
+	return true
+}
+
+func (hs *hintStore) endReplay(node string) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	delete(hs.replaying, node)
+}
+
+// Get the hinted handoff configuration with the default values.
+func (c *Client) hintedHandoff() HintedHandoff {
+	hh := c.getConfig().HintedHandoff
+	if hh.MaxHints <= 0 {
+		hh.MaxHints = defaultMaxHints
+	}
+	if hh.MaxAge <= 0 {
+		hh.MaxAge = defaultMaxHintAge
+	}
+	return hh
+}
+
+// Record the write for the replicas that missed it, if the hinted handoff is enabled and a replica acknowledged the write.
+func (c *Client) hint(m mutation, replicas []ReplicaResult, acked *Response) {
+	hh := c.hintedHandoff()
+	if !hh.Enabled || m == nil || acked == nil {
+		return
+	}
+	for _, r := range replicas {
+		if r.Err == nil || r.Pending {
+			continue
+		}
+		h := m(acked)
+		if h == nil {
+			return
+		}
+		h.Node = r.Node
+		h.Created = c.hints.now()
+		changed, dropped := c.hints.add(h, hh.MaxHints)
+		atomic.AddUint64(&c.metrics.hintsStored, 1)
+		atomic.AddUint64(&c.metrics.hintsDropped, uint64(dropped))
+		c.hints.markDirty(changed...)
+	}
+}
+
+// Remove the pending hint of the object written on the node, superseded by the write.
+func (c *Client) supersedeHint(m mutation, node string, rs *Response) {
+	if m == nil || !c.getConfig().HintedHandoff.Enabled {
+		return
+	}
+	if h := m(rs); h != nil {
+		h.Node = node
+		if c.hints.supersede(h) {
+			c.hints.markDirty(node)
+		}
+	}
+}
+
+// Get the file of the hints of a node.
+func hintFile(dir string, node string) string {
+	return filepath.Join(dir, node+hintFileExt)
+}
+
+// Spool in background the changed hints and discard the expired hints until the client is closed.
+// The changes are coalesced, so that a burst of failover writes rewrites every spool file once.
+func (c *Client) maintainHints() {
+	ticker := time.NewTicker(hintExpiryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.hints.changed:
+			c.flushHints()
+			select {
+			case <-time.After(hintSpoolDelay):
+			case <-c.doneChan:
+				return
+			}
+		case <-ticker.C:
+			c.expireHints()
+		case <-c.doneChan:
+			return
+		}
+	}
+}
+
+// Discard the expired hints.
+func (c *Client) expireHints() {
+	changed, expired := c.hints.expire(c.hints.now(), time.Duration(c.hintedHandoff().MaxAge))
+	if expired > 0 {
+		atomic.AddUint64(&c.metrics.hintsExpired, uint64(expired))
+		c.hints.markDirty(changed...)
+		c.logf("Discarded %d expired hints.\r\n", expired)
+	}
+}
+
+// Discard the hints of the nodes removed from the topology.
+func (c *Client) dropHints(topology *model.OvoTopology) {
+	removed, dropped := c.hints.retain(topology.Nodes)
+	if len(removed) > 0 {
+		atomic.AddUint64(&c.metrics.hintsDropped, uint64(dropped))
+		c.hints.markDirty(removed...)
+		c.logf("Discarded %d hints of the nodes removed from the topology.\r\n", dropped)
+	}
+}
+
+// Write the changed hints in the spool directory.
+func (c *Client) flushHints() {
+	c.spoolHints(c.hints.takeDirty()...)
+}
+
+// Write the hints of the nodes in the spool directory, if configured.
+func (c *Client) spoolHints(nodes ...string) {
+	dir := c.getConfig().HintedHandoff.Dir
+	if dir == "" || len(nodes) == 0 {
+		return
+	}
+	c.hints.spool.Lock()
+	defer c.hints.spool.Unlock()
+	for _, node := range nodes {
+		hints := c.hints.pending(node)
+		path := hintFile(dir, node)
+		if len(hints) == 0 {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				c.logf("Hints of node %s not removed due to %v.\r\n", node, err)
+			}
+			continue
+		}
+		data, err := json.Marshal(hints)
+		if err == nil {
+			err = writeFileAtomic(path, data)
+		}
+		if err != nil {
+			c.logf("Hints of node %s not spooled due to %v.\r\n", node, err)
+		}
+	}
+}
+
+// Read the hints spooled in the directory, if configured.
+func (c *Client) loadHints() {
+	hh := c.hintedHandoff()
+	if !hh.Enabled || hh.Dir == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(hh.Dir)
+	if err != nil {
+		c.logf("Hints not read from %s due to %v.\r\n", hh.Dir, err)
+		return
+	}
+	loaded := make([]*Hint, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), hintFileExt) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(hh.Dir, f.Name()))
+		hints := make([]*Hint, 0)
+		if err == nil {
+			err = json.Unmarshal(data, &hints)
+		}
+		if err != nil {
+			c.logf("Hints file %s not valid.\r\n", f.Name())
+			continue
+		}
+		loaded = append(loaded, hints...)
+	}
+	sort.SliceStable(loaded, func(i, j int) bool { return loaded[i].Created.Before(loaded[j].Created) })
+	for _, h := range loaded {
+		c.hints.add(h, hh.MaxHints)
+	}
+	if len(loaded) > 0 {
+		c.logf("Loaded %d hints from %s.\r\n", len(loaded), hh.Dir)
+	}
+}
+
+// Replay in background the pending hints of a node that is alive and active.
+func (c *Client) replayHints(s *Session) {
+	name := s.Node().Name
+	if !c.health.isServing(name) || !c.hints.startReplay(name) {
+		return
+	}
+	go func() {
+		defer c.hints.endReplay(name)
+		maxAge := time.Duration(c.hintedHandoff().MaxAge)
+		now := c.hints.now()
+		replayed, expired := 0, 0
+		for _, h := range c.hints.pending(name) {
+			select {
+			case <-c.doneChan:
+				return
+			default:
+			}
+			if h.expired(now, maxAge) {
+				c.hints.done(h)
+				expired++
+				atomic.AddUint64(&c.metrics.hintsExpired, 1)
+				continue
+			}
+			// a write on the node after the snapshot supersedes the hint, which must not overwrite it
+			if !c.hints.isPending(h) {
+				continue
+			}
+			if _, err := c.classified(c.hintOp(h))(context.Background(), s); err != nil {
+				c.logf("Replay of the hints of node %s stopped due to %v.\r\n", name, err)
+				break
+			}
+			c.hints.done(h)
+			replayed++
+			atomic.AddUint64(&c.metrics.hintsReplayed, 1)
+		}
+		if replayed > 0 || expired > 0 {
+			c.hints.markDirty(name)
+			c.logf("Replayed %d hints on node %s (%d expired).\r\n", replayed, name, expired)
+		}
+	}()
+}
+
+// Get the operation that replays a hint.
+func (c *Client) hintOp(h *Hint) nodeOp {
+	hash := c.slot(h.Key)
+	ttl := h.TTL
+	if ttl > 0 {
+		// the remaining time to live, at least one second
+		if ttl -= int(c.hints.now().Sub(h.Created) / time.Second); ttl < 1 {
+			ttl = 1
+		}
+	}
+	return func(ctx context.Context, s *Session) (*Response, error) {
+		host := s.Node().Host
+		switch h.Op {
+		case hintPut:
+			mdata := &model.OvoKVRequest{Key: h.Key, Data: h.Data, Hash: hash, TTL: ttl}
+			return s.WithContext(ctx).Post(createKeyStorageEndpoint(host, s.port), mdata, &model.OvoResponse{}, nil)
+		case hintDelete:
+			return s.WithContext(ctx).Delete(createGetKeyStorageEndpoint(host, s.port, h.Key), nil, &model.OvoResponse{}, nil)
+		case hintUpdate:
+			mdata := &model.OvoKVUpdateRequest{Key: h.Key, Data: h.Old, NewData: h.Data, Hash: hash}
+			rs, err := s.WithContext(ctx).Post(createUpdateValueIfEqualEndpoint(host, s.port, h.Key), mdata, &model.OvoResponse{}, nil)
+			if err != nil || rs.status == 200 || rs.status >= 500 {
+				return rs, err
+			}
+			// the node missed also the previous value: the new value is written, without time to live
+			mput := &model.OvoKVRequest{Key: h.Key, Data: h.Data, Hash: hash}
+			return s.WithContext(ctx).Post(createKeyStorageEndpoint(host, s.port), mput, &model.OvoResponse{}, nil)
+		case hintSetCounter:
+			mdata := &model.OvoCounter{Key: h.Key, Value: h.Value, Hash: hash, TTL: ttl}
+			return s.WithContext(ctx).Post(createCountersEndpoint(host, s.port), mdata, &model.OvoCounterResponse{}, nil)
+		}
+		return s.WithContext(ctx).Delete(createCounterEndpoint(host, s.port, h.Key), nil, &model.OvoResponse{}, nil)
+	}
+}
+
+// Get the number of pending hints by node.
+func (c *Client) PendingHints() map[string]int {
+	c.hints.mux.Lock()
+	defer c.hints.mux.Unlock()
+	pending := make(map[string]int)
+	for name, hints := range c.hints.nodes {
+		if len(hints) > 0 {
+			pending[name] = len(hints)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,220 @@
+package ovoclient
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// Wait until the condition is true or the timeout elapses.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func hintedConfig(fc *fakeCluster, hh HintedHandoff) *Configuration {
+	config := fc.config()
+	config.HealthCheckPeriod = Duration(20 * time.Millisecond)
+	hh.Enabled = true
+	config.HintedHandoff = hh
+	return config
+}
+
+func TestHintedHandoffReplay(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(hintedConfig(fc, HintedHandoff{}))
+	defer c.Close()
+	owner := fc.owner("hinted")
+	owner.setStatus(503)
+	if err := c.Put("hinted", "value", 0); !IsDurable(err) {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Increment("hinted", 2, 0); !IsDurable(err) {
+			t.Fatal(err)
+		}
+	}
+	// the increments are recorded as the last value of the counter
+	if n := c.PendingHints()[owner.node.Name]; n != 2 {
+		t.Fatalf("%d pending hints", n)
+	}
+	owner.setStatus(0)
+	if !waitFor(t, 2*time.Second, func() bool { return len(c.PendingHints()) == 0 }) {
+		t.Fatalf("hints not replayed: %v", c.PendingHints())
+	}
+	if data, _ := owner.value("hinted"); string(data) != `"value"` {
+		t.Errorf("value not replayed: %s", data)
+	}
+	if owner.counter("hinted") != 4 {
+		t.Errorf("counter not replayed: %d", owner.counter("hinted"))
+	}
+	if m := c.Metrics(); m.HintsStored != 3 || m.HintsReplayed != 2 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestHintedHandoffConditionalUpdate(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(hintedConfig(fc, HintedHandoff{}))
+	defer c.Close()
+	owner := fc.owner("updated")
+	if err := c.Put("updated", "old", 0, UseWriteConsistency(All)); err != nil {
+		t.Fatal(err)
+	}
+	owner.setStatus(503)
+	if err := c.UpdateValueIfEqual("updated", "old", "new"); !IsDurable(err) {
+		t.Fatal(err)
+	}
+	if n := c.PendingHints()[owner.node.Name]; n != 1 {
+		t.Fatalf("%d pending hints", n)
+	}
+	owner.setStatus(0)
+	if !waitFor(t, 2*time.Second, func() bool { return len(c.PendingHints()) == 0 }) {
+		t.Fatalf("hints not replayed: %v", c.PendingHints())
+	}
+	if data, _ := owner.value("updated"); string(data) != `"new"` {
+		t.Errorf("update not replayed: %s", data)
+	}
+}
+
+func TestHintedHandoffSpool(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	dir := t.TempDir()
+	owner := fc.owner("spooled")
+	c := NewClientFromConfig(hintedConfig(fc, HintedHandoff{Dir: dir}))
+	owner.setStatus(503)
+	if err := c.Delete("spooled"); !IsDurable(err) {
+		t.Fatal(err)
+	}
+	c.Close()
+	if _, err := os.Stat(hintFile(dir, owner.node.Name)); err != nil {
+		t.Fatalf("hints not spooled: %v", err)
+	}
+	// the hints survive a restart
+	owner.store("spooled", []byte(`"stale"`))
+	owner.setStatus(0)
+	c = NewClientFromConfig(hintedConfig(fc, HintedHandoff{Dir: dir}))
+	defer c.Close()
+	if !waitFor(t, 2*time.Second, func() bool { return c.Metrics().HintsReplayed == 1 }) {
+		t.Fatalf("hints not replayed: %v", c.PendingHints())
+	}
+	if _, ok := owner.value("spooled"); ok {
+		t.Error("delete not replayed")
+	}
+	removed := func() bool {
+		_, err := os.Stat(hintFile(dir, owner.node.Name))
+		return os.IsNotExist(err)
+	}
+	if !waitFor(t, time.Second, removed) {
+		t.Error("spool file not removed")
+	}
+}
+
+// A clock moved forward by the tests.
+type fakeClock struct {
+	mux sync.Mutex
+	t   time.Time
+}
+
+func (fc *fakeClock) now() time.Time {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+	return fc.t
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	fc.mux.Lock()
+	defer fc.mux.Unlock()
+	fc.t = fc.t.Add(d)
+}
+
+// Get count keys owned by the node.
+func ownedKeys(fc *fakeCluster, fn *fakeNode, count int) []string {
+	keys := make([]string, 0, count)
+	for i := 0; len(keys) < count; i++ {
+		if key := "key" + strconv.Itoa(i); fc.owner(key) == fn {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestHintedHandoffLimits(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	// the node stays down, so that its hints are never replayed
+	down := fc.nodes[1]
+	down.setStatus(503)
+	c := NewClientFromConfig(hintedConfig(fc, HintedHandoff{MaxHints: 2, MaxAge: Duration(time.Hour)}))
+	defer c.Close()
+	clock := &fakeClock{t: time.Now()}
+	c.hints.now = clock.now
+	keys := ownedKeys(fc, down, 6)
+	for _, key := range keys {
+		if err := c.Put(key, "value", 0); !IsDurable(err) {
+			t.Fatal(err)
+		}
+		clock.advance(time.Second)
+	}
+	if n := c.PendingHints()[down.node.Name]; n != 2 {
+		t.Errorf("%d pending hints", n)
+	}
+	if m := c.Metrics(); m.HintsDropped != uint64(len(keys)-2) {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	// the old hints are discarded
+	c.expireHints()
+	if c.PendingHints()[down.node.Name] != 2 {
+		t.Fatalf("hints discarded too early: %v", c.PendingHints())
+	}
+	clock.advance(time.Hour)
+	c.expireHints()
+	if len(c.PendingHints()) != 0 {
+		t.Fatalf("hints not discarded: %v", c.PendingHints())
+	}
+	if m := c.Metrics(); m.HintsExpired != 2 || m.HintsReplayed != 0 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestHintsOfRemovedNode(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	dir := t.TempDir()
+	down := fc.nodes[1]
+	down.setStatus(503)
+	c := NewClientFromConfig(hintedConfig(fc, HintedHandoff{Dir: dir}))
+	defer c.Close()
+	for _, key := range ownedKeys(fc, down, 2) {
+		if err := c.Put(key, "value", 0); !IsDurable(err) {
+			t.Fatal(err)
+		}
+	}
+	spooled := func() bool {
+		_, err := os.Stat(hintFile(dir, down.node.Name))
+		return err == nil
+	}
+	if !waitFor(t, time.Second, spooled) {
+		t.Fatal("hints not spooled")
+	}
+	// the node leaves the topology
+	c.publishTopology(&model.OvoTopology{Nodes: fc.topology.Nodes[:1]})
+	if len(c.PendingHints()) != 0 {
+		t.Errorf("hints of the removed node kept: %v", c.PendingHints())
+	}
+	if m := c.Metrics(); m.HintsDropped != 2 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	if !waitFor(t, time.Second, func() bool { return !spooled() }) {
+		t.Error("spool file not removed")
+	}
+}
@@ -0,0 +1,101 @@
+package ovoclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencySamples    = 128 // samples kept for every node
+	minLatencySamples = 16  // samples required to compute a percentile
+	latencyWeight     = 0.2 // weight of the last sample in the moving average
+)
+
+// Latency of the requests sent to a node.
+type nodeLatency struct {
+	samples  []time.Duration
+	next     int
+	recorded int
+	p95      time.Duration
+	average  time.Duration // exponentially weighted moving average of the requests and of the probes
+	averaged bool
+}
+
+// Latency tracker keeps the latency of the last successful requests of every node.
+type latencyTracker struct {
+	mux   sync.Mutex
+	nodes map[string]*nodeLatency
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{nodes: make(map[string]*nodeLatency)}
+}
+
+// Get the latency of a node, created if missing; the caller holds the lock.
+func (t *latencyTracker) node(name string) *nodeLatency {
+	nl, ok := t.nodes[name]
+	if !ok {
+		nl = &nodeLatency{samples: make([]time.Duration, 0, latencySamples)}
+		t.nodes[name] = nl
+	}
+	return nl
+}
+
+// Update the moving average with a latency sample.
+func (nl *nodeLatency) updateAverage(latency time.Duration) {
+	if !nl.averaged {
+		nl.average, nl.averaged = latency, true
+	} else {
+		nl.average += time.Duration(latencyWeight * float64(latency-nl.average))
+	}
+}
+
+// Record the latency of a request.
+func (t *latencyTracker) record(name string, latency time.Duration) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	nl := t.node(name)
+	if len(nl.samples) < latencySamples {
+		nl.samples = append(nl.samples, latency)
+	} else {
+		nl.samples[nl.next] = latency
+	}
+	nl.updateAverage(latency)
+	nl.next = (nl.next + 1) % latencySamples
+	nl.recorded++
+	// the percentile is computed again every minLatencySamples requests
+	if nl.recorded%minLatencySamples == 0 {
+		sorted := append([]time.Duration(nil), nl.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		nl.p95 = sorted[len(sorted)*95/100]
+	}
+}
+
+// Record the latency of a probe in the moving average, so that a node that was slow is chosen again by the read routing
+// when it recovers; the percentile used by the hedged reads keeps only the latency of the requests.
+func (t *latencyTracker) observe(name string, latency time.Duration) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.node(name).updateAverage(latency)
+}
+
+// Get the 95th percentile of the node latency; false if the node has not enough samples.
+func (t *latencyTracker) p95(name string) (time.Duration, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if nl, ok := t.nodes[name]; ok && nl.recorded >= minLatencySamples {
+		return nl.p95, true
+	}
+	return 0, false
+}
+
+// Get the moving average of the node latency; false if the node has no samples.
+func (t *latencyTracker) average(name string) (time.Duration, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if nl, ok := t.nodes[name]; ok {
+		return nl.average, true
+	}
+	return 0, false
+}
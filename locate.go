@@ -0,0 +1,72 @@
+package ovoclient
+
+// Location of a key in the OVO cluster.
+type KeyLocation struct {
+	Key     string
+	Slot    int32 // hash slot of the key
+	Primary ReplicaLocation
+	Twins   []ReplicaLocation
+}
+
+// A node that stores a copy of a key.
+type ReplicaLocation struct {
+	NodeHealth
+	Endpoints []string // endpoints called by the operations on the key
+}
+
+// Route of a hash slot.
+type SlotRoute struct {
+	Slot    int32
+	Primary string   // name of the primary node, empty if no node serves the slot
+	Twins   []string // names of the twin nodes
+}
+
+// Get the hash slot, the nodes and the endpoints that serve the key.
+// It returns ErrNoTopology if the topology was not read and ErrNodeNotFound if no node serves the hash slot.
+func (c *Client) Locate(key string) (KeyLocation, error) {
+	loc := KeyLocation{Key: key, Slot: c.slot(key), Twins: make([]ReplicaLocation, 0)}
+	t := c.routes()
+	s := t.session(loc.Slot)
+	if s == nil {
+		return loc, c.errNodeNotFound()
+	}
+	loc.Primary = c.replicaLocation(s, key)
+	for _, st := range t.twinSessions(s) {
+		loc.Twins = append(loc.Twins, c.replicaLocation(st, key))
+	}
+	return loc, nil
+}
+
+// Get the location of a key on a node.
+func (c *Client) replicaLocation(s *Session, key string) ReplicaLocation {
+	host, port := s.Node().Host, s.port
+	return ReplicaLocation{
+		NodeHealth: c.health.get(s.Node()),
+		Endpoints: []string{
+			createKeyStorageEndpoint(host, port),
+			createGetKeyStorageEndpoint(host, port, key),
+			createGetAndRemoveEndpoint(host, port, key),
+			createUpdateValueIfEqualEndpoint(host, port, key),
+			createDeleteValueIfEqualEndpoint(host, port, key),
+			createCountersEndpoint(host, port),
+			createCounterEndpoint(host, port, key),
+		},
+	}
+}
+
+// Get the routing table of the hash slots.
+func (c *Client) SlotMap() []SlotRoute {
+	t := c.routes()
+	routes := make([]SlotRoute, 0, len(t.slots))
+	for hash, s := range t.slots {
+		route := SlotRoute{Slot: int32(hash), Twins: make([]string, 0)}
+		if s != nil {
+			route.Primary = s.Node().Name
+			for _, st := range t.twinSessions(s) {
+				route.Twins = append(route.Twins, st.Node().Name)
+			}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
@@ -0,0 +1,40 @@
+package ovoclient
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+func TestLocate(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	loc, err := c.Locate("where")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := fc.owner("where")
+	if loc.Slot != GetPositiveHashCode("where", model.MaxNodeNumber) || loc.Primary.Name != owner.node.Name {
+		t.Errorf("unexpected location %+v", loc)
+	}
+	if len(loc.Twins) != 1 || loc.Twins[0].Name != owner.node.Twins[0] {
+		t.Errorf("unexpected twins %+v", loc.Twins)
+	}
+	found := false
+	for _, endpoint := range loc.Primary.Endpoints {
+		found = found || strings.HasSuffix(endpoint, "/ovo/keystorage/where")
+	}
+	if !found {
+		t.Errorf("key endpoint missing in %v", loc.Primary.Endpoints)
+	}
+	routes := c.SlotMap()
+	if len(routes) != model.MaxNodeNumber {
+		t.Fatalf("slot map has %d slots", len(routes))
+	}
+	route := routes[loc.Slot]
+	if route.Primary != owner.node.Name || len(route.Twins) != 1 || route.Twins[0] != owner.node.Twins[0] {
+		t.Errorf("unexpected route %+v", route)
+	}
+}
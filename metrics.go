@@ -0,0 +1,49 @@
+package ovoclient
+
+import (
+	"sync/atomic"
+)
+
+// Metrics of a client.
+type Metrics struct {
+	HedgedReads          uint64 // reads sent also to a twin because the primary was slow
+	HedgeWins            uint64 // hedged reads answered first by the twin
+	HedgeBudgetExhausted uint64 // slow reads not hedged because the budget was exhausted
+	TopologyRefreshes    uint64 // topology refreshes requested by the failed operations
+	NodeDeactivations    uint64 // nodes marked as inactive by the cluster
+	NodeActivations      uint64 // nodes marked as active again by the cluster
+	HintsStored          uint64 // writes recorded for the replicas that missed them
+	HintsReplayed        uint64 // hints replayed on their nodes
+	HintsExpired         uint64 // hints discarded because too old
+	HintsDropped         uint64 // hints dropped because the store was full or their node left the topology
+}
+
+// Counters of the client metrics.
+type clientMetrics struct {
+	hedgedReads          uint64
+	hedgeWins            uint64
+	hedgeBudgetExhausted uint64
+	topologyRefreshes    uint64
+	nodeDeactivations    uint64
+	nodeActivations      uint64
+	hintsStored          uint64
+	hintsReplayed        uint64
+	hintsExpired         uint64
+	hintsDropped         uint64
+}
+
+// Get a snapshot of the client metrics.
+func (c *Client) Metrics() Metrics {
+	return Metrics{
+		HedgedReads:          atomic.LoadUint64(&c.metrics.hedgedReads),
+		HedgeWins:            atomic.LoadUint64(&c.metrics.hedgeWins),
+		HedgeBudgetExhausted: atomic.LoadUint64(&c.metrics.hedgeBudgetExhausted),
+		TopologyRefreshes:    atomic.LoadUint64(&c.metrics.topologyRefreshes),
+		NodeDeactivations:    atomic.LoadUint64(&c.metrics.nodeDeactivations),
+		NodeActivations:      atomic.LoadUint64(&c.metrics.nodeActivations),
+		HintsStored:          atomic.LoadUint64(&c.metrics.hintsStored),
+		HintsReplayed:        atomic.LoadUint64(&c.metrics.hintsReplayed),
+		HintsExpired:         atomic.LoadUint64(&c.metrics.hintsExpired),
+		HintsDropped:         atomic.LoadUint64(&c.metrics.hintsDropped),
+	}
+}
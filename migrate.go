@@ -0,0 +1,299 @@
+package ovoclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCheckpointEvery = 100
+	maxMismatchedKeys      = 1000
+)
+
+// Options of a migration.
+type MigrateOptions struct {
+	Prefix          string         // copy only the keys starting with the prefix
+	Counters        []string       // counters to copy
+	Conflict        ConflictPolicy // what to do when a key is already stored on the target
+	TTL             int            // time to live in seconds of the copied keys and counters, the one reported by the source if zero
+	Concurrency     int            // number of concurrent copies, 1 if not set
+	Rate            int            // maximum number of keys copied per second, unlimited if zero
+	Checkpoint      string         // file where the progress is saved; an interrupted migration resumes from it
+	CheckpointEvery int            // number of keys copied between two checkpoints, 100 if not set
+	Verify          bool           // read every copied key again from both the clusters and compare the values
+}
+
+// Statistics of a migration.
+type MigrateStats struct {
+	Keys           int      // keys copied
+	Counters       int      // counters copied
+	Skipped        int      // keys removed from the source during the migration or already stored on the target
+	Failed         int      // keys and counters that could not be copied
+	Verified       int      // keys and counters verified
+	Mismatched     int      // keys and counters whose values differ after the copy
+	MismatchedKeys []string // first mismatched keys, at most 1000
+	Resumed        bool     // the migration resumed from a checkpoint
+}
+
+// Progress of a migration saved in the checkpoint file.
+type migrateCheckpoint struct {
+	LastKey        string   // the keys up to LastKey (in lexical order) were copied
+	Counters       bool     // the counters were copied
+	FailedKeys     []string // keys that could not be copied, copied again by the next run
+	FailedCounters []string // counters that could not be copied, copied again by the next run
+	Done           bool
+	Stats          MigrateStats
+}
+
+// A Migrator copies the keys and the counters of a OVO cluster to another cluster.
+type Migrator struct {
+	source  *Client
+	target  *Client
+	options MigrateOptions
+}
+
+// Create a migrator from the source cluster to the target cluster.
+func NewMigrator(source, target *Client, opts MigrateOptions) *Migrator {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = defaultCheckpointEvery
+	}
+	return &Migrator{source: source, target: target, options: opts}
+}
+
+// Copy the keys, in lexical order, and then the counters.
+// With a checkpoint file the progress is saved every CheckpointEvery keys and a new run resumes after the last saved key;
+// a completed migration is not run again until the checkpoint file is removed.
+// The keys and counters that could not be copied are saved in the checkpoint file and copied again by the next run.
+// The keys created on the source during the migration are not copied if they precede the current key: use a Mirror to send the writes to both the clusters.
+// A failed copy does not stop the migration and the first error is returned together with the statistics;
+// a source node whose keys cannot be listed fails the run before any copy, so that its keys are not lost.
+func (m *Migrator) Run(ctx context.Context) (MigrateStats, error) {
+	if m.options.Conflict == ConflictCAS && len(m.options.Counters) > 0 {
+		return MigrateStats{}, ErrCounterCAS
+	}
+	cp, err := m.loadCheckpoint()
+	if err != nil {
+		return MigrateStats{}, err
+	}
+	if cp.Done {
+		return cp.Stats, nil
+	}
+	sourceKeys, err := m.source.allKeys(ctx)
+	if err != nil {
+		return cp.Stats, fmt.Errorf("migration failed: %v", err)
+	}
+	stats := &cp.Stats
+	stats.Resumed = cp.LastKey != "" || cp.Counters
+	// the failed keys precede LastKey, so the keys stay sorted
+	keys := append([]string(nil), cp.FailedKeys...)
+	counters := cp.FailedCounters
+	if !cp.Counters {
+		counters = m.options.Counters
+	}
+	stats.Failed -= len(cp.FailedKeys) + len(cp.FailedCounters)
+	cp.FailedKeys, cp.FailedCounters = nil, nil
+	for _, key := range sourceKeys {
+		if strings.HasPrefix(key, m.options.Prefix) && (cp.LastKey == "" || key > cp.LastKey) {
+			keys = append(keys, key)
+		}
+	}
+	var throttle <-chan time.Time
+	if m.options.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(m.options.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	var firstErr error
+	for start := 0; start < len(keys); start += m.options.CheckpointEvery {
+		end := start + m.options.CheckpointEvery
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := m.copyBatch(ctx, keys[start:end], false, throttle, stats, &firstErr, &cp.FailedKeys); err != nil {
+			return *stats, err
+		}
+		if keys[end-1] > cp.LastKey {
+			cp.LastKey = keys[end-1]
+		}
+		if err := m.saveCheckpoint(cp); err != nil {
+			return *stats, err
+		}
+	}
+	if err := m.copyBatch(ctx, counters, true, throttle, stats, &firstErr, &cp.FailedCounters); err != nil {
+		return *stats, err
+	}
+	cp.Counters = true
+	cp.Done = len(cp.FailedKeys) == 0 && len(cp.FailedCounters) == 0
+	if err := m.saveCheckpoint(cp); err != nil {
+		return *stats, err
+	}
+	return *stats, firstErr
+}
+
+// Copy a batch of keys or counters concurrently, adding the keys that could not be copied to failed; it returns an error only if the context is done.
+func (m *Migrator) copyBatch(ctx context.Context, keys []string, counters bool, throttle <-chan time.Time, stats *MigrateStats, firstErr *error, failed *[]string) error {
+	var mux sync.Mutex
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < m.options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				var copied, skipped bool
+				var err error
+				if counters {
+					copied, err = m.copyCounter(key)
+					skipped = err == nil && !copied
+				} else {
+					copied, skipped, err = m.copyKey(key)
+				}
+				mismatch := false
+				if err == nil && copied && m.options.Verify {
+					mismatch, err = m.verify(key, counters)
+				}
+				mux.Lock()
+				switch {
+				case err != nil:
+					stats.Failed++
+					*failed = append(*failed, key)
+					if *firstErr == nil {
+						*firstErr = fmt.Errorf("migration of %s failed: %v", key, err)
+					}
+				case skipped:
+					stats.Skipped++
+				case counters:
+					stats.Counters++
+				default:
+					stats.Keys++
+				}
+				if err == nil && copied && m.options.Verify {
+					stats.Verified++
+					if mismatch {
+						stats.Mismatched++
+						if len(stats.MismatchedKeys) < maxMismatchedKeys {
+							stats.MismatchedKeys = append(stats.MismatchedKeys, key)
+						}
+					}
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+	var err error
+	for _, key := range keys {
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+			}
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case jobs <- key:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// Copy a key; it returns false if the key was removed from the source, and skipped if it was already stored on the target.
+// A source that does not answer fails the copy, so that the key is copied again by the next run.
+func (m *Migrator) copyKey(key string) (copied bool, skipped bool, err error) {
+	rs, err := m.source.getRaw(key)
+	if err == ErrKeyNotFound {
+		return false, true, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	rec := &ArchiveRecord{Type: recordKV, Key: key, Data: kvData(rs), TTL: m.ttl(kvTTL(rs))}
+	skipped, err = m.target.importRecord(rec, ImportOptions{Conflict: m.options.Conflict})
+	return !skipped, skipped, err
+}
+
+// Copy a counter; a missing counter is read as zero. It returns false if the counter was already stored on the target.
+func (m *Migrator) copyCounter(key string) (bool, error) {
+	rs, err := m.source.getCounter(key)
+	if err != nil {
+		return false, err
+	}
+	rec := &ArchiveRecord{Type: recordCounter, Key: key, Value: counterValue(rs), TTL: m.ttl(counterTTL(rs))}
+	skipped, err := m.target.importRecord(rec, ImportOptions{Conflict: m.options.Conflict})
+	return !skipped, err
+}
+
+// Get the time to live of a copy: the one of the options, if set, overrides the one of the source.
+func (m *Migrator) ttl(source int) int {
+	if m.options.TTL > 0 {
+		return m.options.TTL
+	}
+	return source
+}
+
+// Compare the values of a key on the two clusters; it returns true if they differ.
+func (m *Migrator) verify(key string, counter bool) (bool, error) {
+	if counter {
+		source, err := m.source.GetCounter(key)
+		if err != nil {
+			return false, err
+		}
+		target, err := m.target.GetCounter(key)
+		return source != target, err
+	}
+	source, err := m.source.GetRawData(key)
+	if err != nil && err != ErrKeyNotFound {
+		return false, err
+	}
+	target, terr := m.target.GetRawData(key)
+	if terr != nil && terr != ErrKeyNotFound {
+		return false, terr
+	}
+	return (err == nil) != (terr == nil) || !bytes.Equal(source, target), nil
+}
+
+// Read the checkpoint file, if configured.
+func (m *Migrator) loadCheckpoint() (*migrateCheckpoint, error) {
+	cp := &migrateCheckpoint{}
+	if m.options.Checkpoint == "" {
+		return cp, nil
+	}
+	data, err := ioutil.ReadFile(m.options.Checkpoint)
+	if os.IsNotExist(err) {
+		return cp, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %v", m.options.Checkpoint, err)
+	}
+	return cp, nil
+}
+
+// Save the checkpoint file, if configured.
+func (m *Migrator) saveCheckpoint(cp *migrateCheckpoint) error {
+	if m.options.Checkpoint == "" {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.options.Checkpoint, data)
+}
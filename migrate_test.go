@@ -0,0 +1,262 @@
+package ovoclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	source := NewClientFromConfig(newFakeCluster(t, 2).config())
+	defer source.Close()
+	target := NewClientFromConfig(newFakeCluster(t, 3).config())
+	defer target.Close()
+	for i := 0; i < 10; i++ {
+		if err := source.Put(fmt.Sprintf("key-%02d", i), i, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source.SetCounter("hits", 42, 0)
+	target.Put("key-00", "newer", 0)
+	checkpoint := filepath.Join(t.TempDir(), "migration.json")
+	opts := MigrateOptions{Counters: []string{"hits"}, Conflict: ConflictSkip, Concurrency: 3, Checkpoint: checkpoint, CheckpointEvery: 4, Verify: true}
+	stats, err := NewMigrator(source, target, opts).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 9 || stats.Skipped != 1 || stats.Counters != 1 || stats.Verified != 10 || stats.Mismatched != 0 || stats.Resumed {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	var value int
+	if err := target.Get("key-07", &value); err != nil || value != 7 {
+		t.Errorf("key-07 not copied: %d, %v", value, err)
+	}
+	if n, _ := target.GetCounter("hits"); n != 42 {
+		t.Errorf("counter not copied: %d", n)
+	}
+	// a completed migration is not run again
+	source.Put("key-99", 99, 0)
+	if again, err := NewMigrator(source, target, opts).Run(context.Background()); err != nil || again.Keys != stats.Keys {
+		t.Errorf("unexpected stats %+v, %v", again, err)
+	}
+	if _, err := target.GetRawData("key-99"); err != ErrKeyNotFound {
+		t.Errorf("completed migration run again: %v", err)
+	}
+}
+
+func TestMigratorResume(t *testing.T) {
+	source := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer source.Close()
+	target := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer target.Close()
+	for i := 0; i < 6; i++ {
+		source.Put(fmt.Sprintf("key-%02d", i), i, 0)
+	}
+	checkpoint := filepath.Join(t.TempDir(), "migration.json")
+	data, _ := json.Marshal(&migrateCheckpoint{LastKey: "key-03", Stats: MigrateStats{Keys: 4}})
+	if err := ioutil.WriteFile(checkpoint, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := NewMigrator(source, target, MigrateOptions{Checkpoint: checkpoint, Rate: 100}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 6 || !stats.Resumed {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, err := target.GetRawData("key-03"); err != ErrKeyNotFound {
+		t.Errorf("key before the checkpoint copied: %v", err)
+	}
+	if _, err := target.GetRawData("key-04"); err != nil {
+		t.Errorf("key after the checkpoint not copied: %v", err)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	source := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer source.Close()
+	fc := newFakeCluster(t, 1)
+	target := NewClientFromConfig(fc.config())
+	defer target.Close()
+	failed := make([]string, 0)
+	m := NewMirror(source, target, func(key string, err error) { failed = append(failed, key) })
+	if err := m.Put("mirrored", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := m.Increment("visits", 3, 0); err != nil || n != 3 {
+		t.Fatalf("Increment returned %d, %v", n, err)
+	}
+	for _, c := range []*Client{source, target} {
+		var value string
+		if err := c.Get("mirrored", &value); err != nil || value != "value" {
+			t.Errorf("Get returned %q, %v", value, err)
+		}
+		if n, _ := c.GetCounter("visits"); n != 3 {
+			t.Errorf("counter not mirrored: %d", n)
+		}
+	}
+	// the reads follow the selected cluster
+	target.Put("target-only", "target", 0)
+	m.SetReadSource(ReadFromTarget)
+	var value string
+	if err := m.Get("target-only", &value); err != nil || value != "target" {
+		t.Errorf("Get returned %q, %v", value, err)
+	}
+	// the failures of the other cluster are reported, not returned
+	m.SetReadSource(ReadFromSource)
+	fc.nodes[0].setStatus(503)
+	if err := m.Delete("mirrored"); err != nil {
+		t.Fatal(err)
+	}
+	if m.MirrorErrors() != 1 || len(failed) != 1 || failed[0] != "mirrored" {
+		t.Errorf("unexpected mirror errors %d %v", m.MirrorErrors(), failed)
+	}
+	if _, err := source.GetRawData("mirrored"); err != ErrKeyNotFound {
+		t.Errorf("key not deleted from the source: %v", err)
+	}
+}
+
+func TestMigratorRetry(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	source := NewClientFromConfig(fc.config())
+	defer source.Close()
+	target := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer target.Close()
+	for i := 0; i < 3; i++ {
+		source.Put(fmt.Sprintf("key-%02d", i), i, 0)
+	}
+	checkpoint := filepath.Join(t.TempDir(), "migration.json")
+	m := NewMigrator(source, target, MigrateOptions{Checkpoint: checkpoint})
+	// an unreachable source fails the copy
+	fc.nodes[0].setStatus(503)
+	stats := &MigrateStats{}
+	var firstErr error
+	failed := make([]string, 0)
+	if err := m.copyBatch(context.Background(), []string{"key-01"}, false, nil, stats, &firstErr, &failed); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Failed != 1 || stats.Skipped != 0 || firstErr == nil || len(failed) != 1 {
+		t.Fatalf("unexpected stats %+v, %v", stats, firstErr)
+	}
+	fc.nodes[0].setStatus(0)
+	// the failed keys are copied again by the next run
+	data, _ := json.Marshal(&migrateCheckpoint{LastKey: "key-02", Counters: true, FailedKeys: failed, Stats: MigrateStats{Keys: 2, Failed: 1}})
+	if err := ioutil.WriteFile(checkpoint, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := m.Run(context.Background())
+	if err != nil || result.Keys != 3 || result.Failed != 0 {
+		t.Fatalf("unexpected stats %+v, %v", result, err)
+	}
+	if _, err := target.GetRawData("key-01"); err != nil {
+		t.Errorf("failed key not copied again: %v", err)
+	}
+	if cp, _ := m.loadCheckpoint(); !cp.Done || len(cp.FailedKeys) != 0 {
+		t.Errorf("unexpected checkpoint %+v", cp)
+	}
+}
+
+func TestMirrorDurableWrite(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	source := NewClientFromConfig(fc.config())
+	defer source.Close()
+	target := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer target.Close()
+	m := NewMirror(source, target, nil)
+	// the primary node of the keys fails, so the writes on the source are acknowledged only by the twin
+	down := fc.nodes[1]
+	keys := ownedKeys(fc, down, 2)
+	down.setStatus(503)
+	if err := m.Put(keys[0], "value", 0); err == nil || !IsDurable(err) {
+		t.Fatalf("durable error expected: %v", err)
+	}
+	if n, err := m.Increment(keys[1], 5, 0); err == nil || !IsDurable(err) || n != 5 {
+		t.Fatalf("Increment returned %d, %v", n, err)
+	}
+	var value string
+	if err := target.Get(keys[0], &value); err != nil || value != "value" {
+		t.Errorf("durable write not mirrored: %q, %v", value, err)
+	}
+	if n, _ := target.GetCounter(keys[1]); n != 5 {
+		t.Errorf("durable increment not mirrored: %d", n)
+	}
+	if err := m.Delete(keys[0]); err == nil || !IsDurable(err) {
+		t.Fatalf("durable error expected: %v", err)
+	}
+	if _, err := target.GetRawData(keys[0]); err != ErrKeyNotFound {
+		t.Errorf("durable delete not mirrored: %v", err)
+	}
+	if m.MirrorErrors() != 0 {
+		t.Errorf("unexpected mirror errors %d", m.MirrorErrors())
+	}
+}
+
+func TestMigratorTTL(t *testing.T) {
+	source := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer source.Close()
+	fc := newFakeCluster(t, 1)
+	target := NewClientFromConfig(fc.config())
+	defer target.Close()
+	source.Put("session", "value", 60)
+	source.SetCounter("visits", 3, 120)
+	opts := MigrateOptions{Counters: []string{"visits"}}
+	if _, err := NewMigrator(source, target, opts).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if node := fc.nodes[0]; node.ttl("session") != 60 || node.ttl("#visits") != 120 {
+		t.Errorf("time to live of the source not kept: %d, %d", node.ttl("session"), node.ttl("#visits"))
+	}
+	// the time to live of the options overrides the one of the source
+	opts.TTL = 3600
+	if _, err := NewMigrator(source, target, opts).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if node := fc.nodes[0]; node.ttl("session") != 3600 || node.ttl("#visits") != 3600 {
+		t.Errorf("time to live not overridden: %d, %d", node.ttl("session"), node.ttl("#visits"))
+	}
+	opts.Conflict = ConflictCAS
+	if _, err := NewMigrator(source, target, opts).Run(context.Background()); err != ErrCounterCAS {
+		t.Errorf("compare-and-swap of the counters accepted: %v", err)
+	}
+}
+
+func TestMigratorUnlistedSource(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	source := NewClientFromConfig(fc.config())
+	defer source.Close()
+	target := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer target.Close()
+	source.Put(ownedKeys(fc, fc.nodes[1], 1)[0], "value", 0)
+	fc.nodes[1].setStatus(503)
+	checkpoint := filepath.Join(t.TempDir(), "migration.json")
+	if _, err := NewMigrator(source, target, MigrateOptions{Checkpoint: checkpoint}).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "not listed") {
+		t.Fatalf("unlisted source node not reported: %v", err)
+	}
+	// the failed run is not completed, so it can be run again
+	if cp, err := NewMigrator(source, target, MigrateOptions{Checkpoint: checkpoint}).loadCheckpoint(); err != nil || cp.Done {
+		t.Errorf("unexpected checkpoint %+v, %v", cp, err)
+	}
+}
+
+func TestMirrorConditionalUpdateTTL(t *testing.T) {
+	source := NewClientFromConfig(newFakeCluster(t, 1).config())
+	defer source.Close()
+	fc := newFakeCluster(t, 1)
+	target := NewClientFromConfig(fc.config())
+	defer target.Close()
+	var store KeyValueStore = NewMirror(source, target, nil)
+	if err := store.Put("session", "old", 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateValueIfEqual("session", "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if err := target.Get("session", &value); err != nil || value != "new" || fc.nodes[0].ttl("session") != 60 {
+		t.Errorf("update mirrored as %q with ttl %d, %v", value, fc.nodes[0].ttl("session"), err)
+	}
+}
@@ -0,0 +1,228 @@
+package ovoclient
+
+import (
+	"sync/atomic"
+)
+
+// The key-value operations of a Client; a Mirror implements them too, so the code using them can switch to the mirroring.
+// The operations bound to a cluster, like Keys, Count and Topology, are not part of it.
+type KeyValueStore interface {
+	Put(key string, data interface{}, ttl int, opts ...CallOption) error
+	PutRawData(key string, data []byte, ttl int, opts ...CallOption) error
+	Get(key string, data interface{}, opts ...CallOption) error
+	GetRawData(key string, opts ...CallOption) ([]byte, error)
+	Delete(key string, opts ...CallOption) error
+	GetAndRemove(key string, data interface{}, opts ...CallOption) error
+	GetAndRemoveRawData(key string, opts ...CallOption) ([]byte, error)
+	UpdateValueIfEqual(key string, oldData interface{}, newData interface{}, opts ...CallOption) error
+	DeleteValueIfEqual(key string, oldData interface{}, opts ...CallOption) error
+	Increment(key string, value int64, ttl int, opts ...CallOption) (int64, error)
+	SetCounter(key string, value int64, ttl int, opts ...CallOption) (int64, error)
+	GetCounter(key string, opts ...CallOption) (int64, error)
+	DeleteCounter(key string, opts ...CallOption) error
+}
+
+var (
+	_ KeyValueStore = (*Client)(nil)
+	_ KeyValueStore = (*Mirror)(nil)
+)
+
+// Cluster answering the reads of a Mirror.
+type MirrorSource int32
+
+const (
+	// The reads are answered by the source cluster.
+	ReadFromSource MirrorSource = iota
+	// The reads are answered by the target cluster.
+	ReadFromTarget
+)
+
+// A Mirror sends the writes to two OVO clusters and the reads to a selectable cluster; it is used to move to a new cluster without downtime:
+// the writes are mirrored while a Migrator copies the old keys, then the reads are moved to the target cluster.
+// A write is executed first on the cluster answering the reads, whose error is returned, and then on the other cluster
+// if it failed only with a durable *ReplicationError; the errors of the other cluster are counted and sent to the error handler.
+// The counters are written on the other cluster with the value of the first cluster. The conditional updates are mirrored as conditional updates,
+// so that the other cluster keeps the time to live of the object; a key missing on the other cluster is left to the Migrator.
+type Mirror struct {
+	source  *Client
+	target  *Client
+	reads   int32
+	errors  uint64
+	onError func(key string, err error)
+}
+
+// Create a mirror of the source and target clusters; the reads are answered by the source cluster.
+// The handler, if not nil, receives the errors of the writes on the cluster that does not answer the reads.
+func NewMirror(source, target *Client, onError func(key string, err error)) *Mirror {
+	return &Mirror{source: source, target: target, onError: onError}
+}
+
+// Select the cluster answering the reads.
+func (m *Mirror) SetReadSource(source MirrorSource) {
+	atomic.StoreInt32(&m.reads, int32(source))
+}
+
+// Get the cluster answering the reads.
+func (m *Mirror) ReadSource() MirrorSource {
+	return MirrorSource(atomic.LoadInt32(&m.reads))
+}
+
+// Get the number of failed writes on the cluster that does not answer the reads.
+func (m *Mirror) MirrorErrors() uint64 {
+	return atomic.LoadUint64(&m.errors)
+}
+
+// Get the cluster answering the reads and the other cluster.
+func (m *Mirror) clients() (*Client, *Client) {
+	if m.ReadSource() == ReadFromTarget {
+		return m.target, m.source
+	}
+	return m.source, m.target
+}
+
+// Record the error of a write on the other cluster.
+func (m *Mirror) mirrored(key string, err error) {
+	if IsDurable(err) {
+		return
+	}
+	atomic.AddUint64(&m.errors, 1)
+	if m.onError != nil {
+		m.onError(key, err)
+	}
+}
+
+// Put data in raw format on both the clusters.
+func (m *Mirror) PutRawData(key string, data []byte, ttl int, opts ...CallOption) error {
+	first, other := m.clients()
+	err := first.PutRawData(key, data, ttl, opts...)
+	if !IsDurable(err) {
+		return err
+	}
+	m.mirrored(key, other.PutRawData(key, data, ttl, opts...))
+	return err
+}
+
+// Put the object on both the clusters serializing it with the codec of the cluster answering the reads.
+func (m *Mirror) Put(key string, data interface{}, ttl int, opts ...CallOption) error {
+	first, _ := m.clients()
+	bdata, err := first.getConfig().Codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return m.PutRawData(key, bdata, ttl, opts...)
+}
+
+// Get the raw data of an object from the cluster answering the reads.
+func (m *Mirror) GetRawData(key string, opts ...CallOption) ([]byte, error) {
+	first, _ := m.clients()
+	return first.GetRawData(key, opts...)
+}
+
+// Retrieve an object from the cluster answering the reads.
+func (m *Mirror) Get(key string, data interface{}, opts ...CallOption) error {
+	first, _ := m.clients()
+	return first.Get(key, data, opts...)
+}
+
+// Delete an object from both the clusters.
+func (m *Mirror) Delete(key string, opts ...CallOption) error {
+	first, other := m.clients()
+	err := first.Delete(key, opts...)
+	if !IsDurable(err) {
+		return err
+	}
+	if derr := other.Delete(key, opts...); derr != ErrKeyNotFound {
+		m.mirrored(key, derr)
+	}
+	return err
+}
+
+// Retrieve the raw data of an object from the cluster answering the reads and remove it from both the clusters.
+func (m *Mirror) GetAndRemoveRawData(key string, opts ...CallOption) ([]byte, error) {
+	first, other := m.clients()
+	data, err := first.GetAndRemoveRawData(key, opts...)
+	if !IsDurable(err) && err != ErrKeyNotFound {
+		return nil, err
+	}
+	if derr := other.Delete(key, opts...); derr != ErrKeyNotFound {
+		m.mirrored(key, derr)
+	}
+	return data, err
+}
+
+// Retrieve an object from the cluster answering the reads and remove it from both the clusters.
+func (m *Mirror) GetAndRemove(key string, data interface{}, opts ...CallOption) error {
+	first, _ := m.clients()
+	bdata, err := m.GetAndRemoveRawData(key, opts...)
+	if err != nil {
+		return err
+	}
+	return first.getConfig().Codec.Unmarshal(bdata, data)
+}
+
+// Update an object with the newData if the oldData is equal to the data stored on the cluster answering the reads.
+func (m *Mirror) UpdateValueIfEqual(key string, oldData interface{}, newData interface{}, opts ...CallOption) error {
+	first, other := m.clients()
+	err := first.UpdateValueIfEqual(key, oldData, newData, opts...)
+	if !IsDurable(err) {
+		return err
+	}
+	if uerr := other.UpdateValueIfEqual(key, oldData, newData, opts...); uerr != ErrKeyNotFound {
+		m.mirrored(key, uerr)
+	}
+	return err
+}
+
+// Delete an object from both the clusters if its value on the cluster answering the reads is not changed.
+func (m *Mirror) DeleteValueIfEqual(key string, oldData interface{}, opts ...CallOption) error {
+	first, other := m.clients()
+	err := first.DeleteValueIfEqual(key, oldData, opts...)
+	if !IsDurable(err) {
+		return err
+	}
+	if derr := other.Delete(key, opts...); derr != ErrKeyNotFound {
+		m.mirrored(key, derr)
+	}
+	return err
+}
+
+// Increment (or decrement) the counter of the cluster answering the reads and set the same value on the other cluster.
+func (m *Mirror) Increment(key string, value int64, ttl int, opts ...CallOption) (int64, error) {
+	first, other := m.clients()
+	result, err := first.Increment(key, value, ttl, opts...)
+	if !IsDurable(err) {
+		return result, err
+	}
+	_, merr := other.SetCounter(key, result, ttl, opts...)
+	m.mirrored(key, merr)
+	return result, err
+}
+
+// Set the value of the counter on both the clusters.
+func (m *Mirror) SetCounter(key string, value int64, ttl int, opts ...CallOption) (int64, error) {
+	first, other := m.clients()
+	result, err := first.SetCounter(key, value, ttl, opts...)
+	if !IsDurable(err) {
+		return result, err
+	}
+	_, merr := other.SetCounter(key, result, ttl, opts...)
+	m.mirrored(key, merr)
+	return result, err
+}
+
+// Get the value of the counter from the cluster answering the reads.
+func (m *Mirror) GetCounter(key string, opts ...CallOption) (int64, error) {
+	first, _ := m.clients()
+	return first.GetCounter(key, opts...)
+}
+
+// Delete the counter from both the clusters.
+func (m *Mirror) DeleteCounter(key string, opts ...CallOption) error {
+	first, other := m.clients()
+	err := first.DeleteCounter(key, opts...)
+	if !IsDurable(err) {
+		return err
+	}
+	m.mirrored(key, other.DeleteCounter(key, opts...))
+	return err
+}
@@ -32,6 +32,7 @@ type OvoKVUpdateRequest struct {
 type OvoKVResponse struct {
 	Key  string
 	Data []byte
+	TTL  int `json:",omitempty"` // remaining time to live in seconds, not reported by every server version
 }
 
 type OvoKVKeys struct {
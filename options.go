@@ -0,0 +1,251 @@
+package ovoclient
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrNoSeedAvailable is returned by New in fail-fast mode when no seed node answered.
+var ErrNoSeedAvailable = errors.New("No seed node available.")
+
+// Startup mode of the client.
+type StartupMode int
+
+const (
+	// The client is returned even if no seed node answered; the topology is loaded in background.
+	StartupLazy StartupMode = iota
+	// New returns ErrNoSeedAvailable if no seed node answered; the constructors without error log it and return the client anyway.
+	StartupFailFast
+)
+
+// A Logger receives the log messages of a client.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// An Option configures a client created with New.
+type Option func(*Configuration) error
+
+// Create a client configured by the options.
+func New(opts ...Option) (*Client, error) {
+	config := &Configuration{}
+	for i, opt := range opts {
+		path := config.configPath
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+		if config.configPath != path {
+			config.overrides = opts[i+1:]
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client, err := newClientE(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.configPath != "" {
+		client.watchConfig(config.configPath)
+	}
+	return client, nil
+}
+
+// Use a copy of the configuration as the base of the following options.
+func WithConfiguration(base *Configuration) Option {
+	return func(config *Configuration) error {
+		*config = *base
+		config.ClusterNodes = append([]Node(nil), base.ClusterNodes...)
+		return nil
+	}
+}
+
+// Load the configuration file as the base of the following options; with ReloadPeriod the file is watched
+// and the following options are applied again to every reloaded configuration, so they take precedence over the file.
+func WithConfigFile(path string) Option {
+	return func(config *Configuration) error {
+		base, err := LoadConfigurationE(path)
+		if err != nil {
+			return err
+		}
+		*config = *base
+		config.configPath = path
+		return nil
+	}
+}
+
+// Add the seed nodes, in host:port format.
+func WithSeeds(addrs ...string) Option {
+	return func(config *Configuration) error {
+		for _, addr := range addrs {
+			nodes, err := ParseNodes(addr)
+			if err != nil {
+				return err
+			}
+			config.ClusterNodes = append(config.ClusterNodes, nodes...)
+		}
+		return nil
+	}
+}
+
+// Set the transport of the HTTP sessions.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(config *Configuration) error {
+		config.Transport = transport
+		return nil
+	}
+}
+
+// Set the codec used to serialize the objects.
+func WithCodec(codec Codec) Option {
+	return func(config *Configuration) error {
+		config.Codec = codec
+		return nil
+	}
+}
+
+// Set the logger of the client.
+func WithLogger(logger Logger) Option {
+	return func(config *Configuration) error {
+		config.Logger = logger
+		return nil
+	}
+}
+
+// Set the period of the topology check.
+func WithClusterCheckPeriod(period time.Duration) Option {
+	return func(config *Configuration) error {
+		config.ClusterCheckPeriod = Duration(period)
+		return nil
+	}
+}
+
+// Set the period of the node probes.
+func WithHealthCheckPeriod(period time.Duration) Option {
+	return func(config *Configuration) error {
+		config.HealthCheckPeriod = Duration(period)
+		return nil
+	}
+}
+
+// Set the startup mode.
+func WithStartupMode(mode StartupMode) Option {
+	return func(config *Configuration) error {
+		config.StartupMode = mode
+		return nil
+	}
+}
+
+// Set the default write consistency.
+func WithWriteConsistency(level Consistency) Option {
+	return func(config *Configuration) error {
+		config.WriteConsistency = level
+		return nil
+	}
+}
+
+// Set the default read consistency.
+func WithReadConsistency(level Consistency) Option {
+	return func(config *Configuration) error {
+		config.ReadConsistency = level
+		return nil
+	}
+}
+
+// Enable the read repair after the quorum reads.
+func WithReadRepair(enabled bool) Option {
+	return func(config *Configuration) error {
+		config.ReadRepair = enabled
+		return nil
+	}
+}
+
+// Set the hedging policy of the reads.
+func WithHedging(policy HedgePolicy) Option {
+	return func(config *Configuration) error {
+		config.Hedge = policy
+		return nil
+	}
+}
+
+// Set the routing policy of the reads.
+func WithReadRouting(policy ReadRouting) Option {
+	return func(config *Configuration) error {
+		config.ReadRouting = policy
+		return nil
+	}
+}
+
+// Set the partitioner that maps the keys on the hash slots.
+func WithPartitioner(partitioner Partitioner) Option {
+	return func(config *Configuration) error {
+		config.Partitioner = partitioner
+		return nil
+	}
+}
+
+// Set the handler of the client events.
+func WithEventHandler(handler func(Event)) Option {
+	return func(config *Configuration) error {
+		config.EventHandler = handler
+		return nil
+	}
+}
+
+// Refuse the topologies with uncovered or duplicated slots or unknown twins.
+func WithRejectInvalidTopology(enabled bool) Option {
+	return func(config *Configuration) error {
+		config.RejectInvalidTopology = enabled
+		return nil
+	}
+}
+
+// Set the minimum interval between the topology refreshes requested by the failed operations.
+func WithRefreshDebounce(d time.Duration) Option {
+	return func(config *Configuration) error {
+		config.RefreshDebounce = Duration(d)
+		return nil
+	}
+}
+
+// Save the last known topology in the file and use it when no seed node is available at startup.
+func WithTopologyFile(path string) Option {
+	return func(config *Configuration) error {
+		config.TopologyFile = path
+		return nil
+	}
+}
+
+// Discover the seed nodes using the DNS.
+func WithSeedDiscovery(discovery SeedDiscovery) Option {
+	return func(config *Configuration) error {
+		config.SeedDiscovery = discovery
+		return nil
+	}
+}
+
+// Set the resolver of the seed discovery.
+func WithResolver(resolver Resolver) Option {
+	return func(config *Configuration) error {
+		config.Resolver = resolver
+		return nil
+	}
+}
+
+// Set the policy of the writes to a primary node marked as inactive and the maximum wait of the queued writes.
+func WithInactiveWrites(policy InactiveWritePolicy, timeout time.Duration) Option {
+	return func(config *Configuration) error {
+		config.InactiveWrites = policy
+		config.InactiveWriteTimeout = Duration(timeout)
+		return nil
+	}
+}
+
+// Record the writes missed by the nodes and replay them when the nodes are alive again.
+func WithHintedHandoff(handoff HintedHandoff) Option {
+	return func(config *Configuration) error {
+		config.HintedHandoff = handoff
+		return nil
+	}
+}
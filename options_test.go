@@ -0,0 +1,110 @@
+package ovoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Transport failing every request while it is switched off.
+type switchTransport struct {
+	off int32
+}
+
+func (t *switchTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&t.off) == 1 {
+		return nil, errors.New("transport switched off")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// Codec counting the serialized objects.
+type countingCodec struct {
+	JSONCodec
+	marshaled int32
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&c.marshaled, 1)
+	return json.Marshal(v)
+}
+
+func TestNewFailFast(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	seed := "127.0.0.1:" + strconv.Itoa(fc.nodes[0].node.Port)
+	_, err := New(WithSeeds(seed), WithTransport(&switchTransport{off: 1}), WithStartupMode(StartupFailFast))
+	if err != ErrNoSeedAvailable {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = New(); err == nil {
+		t.Error("client without seeds created")
+	}
+}
+
+func TestNewClientFromConfigFailFast(t *testing.T) {
+	fc := newFakeCluster(t, 1)
+	transport := &switchTransport{off: 1}
+	config := fc.config()
+	config.Transport = transport
+	config.StartupMode = StartupFailFast
+	// the constructors without error return the client anyway
+	c := NewClientFromConfig(config)
+	if c == nil {
+		t.Fatal("nil client in fail-fast mode")
+	}
+	defer c.Close()
+	if err := c.Put("failfast", "value", 0); err != ErrNoTopology {
+		t.Errorf("unexpected error %v", err)
+	}
+	atomic.StoreInt32(&transport.off, 0)
+	waitFor(t, 5*time.Second, c.hasTopology)
+	if err := c.Put("failfast", "value", 0); err != nil {
+		t.Errorf("Put failed: %v", err)
+	}
+}
+
+func TestNewClientKeepsConfiguration(t *testing.T) {
+	config := newFakeCluster(t, 1).config()
+	config.ClusterCheckPeriod = Duration(time.Millisecond)
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	if config.ClusterCheckPeriod != Duration(time.Millisecond) || config.HealthCheckPeriod != 0 || config.Codec != nil {
+		t.Errorf("configuration of the caller changed: %+v", config)
+	}
+	if c.getConfig() == config || c.getConfig().ClusterCheckPeriod != minClusterCheckPeriod {
+		t.Errorf("unexpected configuration of the client: %+v", c.getConfig())
+	}
+}
+
+func TestNewLazy(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	seed := "127.0.0.1:" + strconv.Itoa(fc.nodes[0].node.Port)
+	transport := &switchTransport{off: 1}
+	codec := &countingCodec{}
+	c, err := New(WithSeeds(seed), WithTransport(transport), WithCodec(codec))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer c.Close()
+	if err = c.Put("lazy", "value", 0); err != ErrNoTopology {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(c.Keys()) != 0 || len(c.Count()) != 0 {
+		t.Error("unexpected keys or counters without topology")
+	}
+	atomic.StoreInt32(&transport.off, 0)
+	deadline := time.Now().Add(5 * time.Second)
+	for !c.hasTopology() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err = c.Put("lazy", "value", 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if atomic.LoadInt32(&codec.marshaled) != 2 {
+		t.Errorf("codec used %d times", codec.marshaled)
+	}
+}
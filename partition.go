@@ -0,0 +1,33 @@
+package ovoclient
+
+import (
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// A Partitioner maps the keys on the hash slots of the cluster.
+// It must compute the hash slots used by the nodes of the cluster.
+type Partitioner interface {
+	Slot(key string) int32 // hash slot of the key
+	SlotCount() int32      // number of hash slots
+}
+
+// The default partitioner: the djb2 hash of GetPositiveHashCode modulo the number of slots, the hash always used by this client.
+type HashPartitioner struct {
+	Slots int32 // number of hash slots, model.MaxNodeNumber if not set
+}
+
+func (p HashPartitioner) Slot(key string) int32 {
+	return GetPositiveHashCode(key, p.SlotCount())
+}
+
+func (p HashPartitioner) SlotCount() int32 {
+	if p.Slots > 0 {
+		return p.Slots
+	}
+	return model.MaxNodeNumber
+}
+
+// Get the hash slot of a key.
+func (c *Client) slot(key string) int32 {
+	return c.routes().partitioner.Slot(key)
+}
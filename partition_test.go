@@ -0,0 +1,81 @@
+package ovoclient
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// Hash slots of the current client hash (GetPositiveHashCode), not taken from the server:
+// they pin the behavior of the default partitioner, which must not change them.
+var goldenSlots = []struct {
+	key      string
+	slot     int32 // with 128 slots
+	slot1024 int32 // with 1024 slots
+}{
+	{"", 126, 766},
+	{"a", 61, 957},
+	{"test12345", 79, 975},
+	{"ciaociao", 126, 894},
+	{"asdfghjklòàèé", 53, 949},
+	{"你好 你好 你好", 47, 175},
+	{"cammello", 108, 620},
+	{"早上好，女士们", 54, 566},
+	{"èéà", 9, 265},
+	{"myObject", 57, 313},
+	{"myCounter", 112, 240},
+	{"user:1000:profile", 31, 927},
+	{"session/8f14e45f", 122, 250},
+	{"a-very-long-key-with-many-characters-0123456789", 71, 327},
+}
+
+func TestHashPartitionerGolden(t *testing.T) {
+	for _, g := range goldenSlots {
+		if slot := (HashPartitioner{}).Slot(g.key); slot != g.slot {
+			t.Errorf("key %q: slot %d, expected %d", g.key, slot, g.slot)
+		}
+		if slot := (HashPartitioner{Slots: 1024}).Slot(g.key); slot != g.slot1024 {
+			t.Errorf("key %q: slot %d of 1024, expected %d", g.key, slot, g.slot1024)
+		}
+	}
+	if count := (HashPartitioner{}).SlotCount(); count != model.MaxNodeNumber {
+		t.Errorf("default slot count %d", count)
+	}
+}
+
+func TestTopologySlotCount(t *testing.T) {
+	c := &Client{transport: &http.Transport{}}
+	c.config.Store(&Configuration{})
+	// a wrong hash range does not change the number of slots
+	topology := &model.OvoTopology{Nodes: []*model.OvoTopologyNode{{Name: "a", HashRange: []int{0, 1}}, {Name: "b", HashRange: []int{2, 255}}}}
+	table, _ := c.newRoutingTable(topology, nil)
+	if count := table.partitioner.SlotCount(); count != model.MaxNodeNumber || len(table.slots) != model.MaxNodeNumber {
+		t.Errorf("slot count %d", count)
+	}
+	c.config.Store(&Configuration{Partitioner: HashPartitioner{Slots: 1024}})
+	table, _ = c.newRoutingTable(topology, nil)
+	if len(table.slots) != 1024 || table.session(255) == nil {
+		t.Errorf("slot count %d of the configured partitioner", len(table.slots))
+	}
+}
+
+// A partitioner that sends every key to the same hash slot.
+type fixedPartitioner int32
+
+func (p fixedPartitioner) Slot(key string) int32 { return int32(p) }
+func (p fixedPartitioner) SlotCount() int32      { return model.MaxNodeNumber }
+
+func TestCustomPartitioner(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.Partitioner = fixedPartitioner(1)
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	if err := c.Put("anything", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fc.nodes[1].value("anything"); !ok {
+		t.Error("key not stored on the node serving the slot of the partitioner")
+	}
+}
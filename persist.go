@@ -0,0 +1,73 @@
+package ovoclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// Save the topology in the topology file, if configured and if the topology changed.
+func (c *Client) saveTopology(topology *model.OvoTopology) {
+	path := c.getConfig().TopologyFile
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(topology)
+	if err != nil {
+		c.logf("Topology not saved due to %v.\r\n", err)
+		return
+	}
+	if bytes.Equal(data, c.savedTopology) {
+		return
+	}
+	if err = writeFileAtomic(path, data); err != nil {
+		c.logf("Topology not saved in %s due to %v.\r\n", path, err)
+		return
+	}
+	c.savedTopology = data
+}
+
+// Replace the file atomically so that a crash never leaves a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Read the last known topology from the topology file, if configured.
+func (c *Client) loadTopologyFile() bool {
+	path := c.getConfig().TopologyFile
+	if path == "" {
+		return false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logf("Topology file %s not read due to %v.\r\n", path, err)
+		}
+		return false
+	}
+	topology := &model.OvoTopology{}
+	if err = json.Unmarshal(data, topology); err != nil || len(topology.Nodes) == 0 {
+		c.logf("Topology file %s not valid.\r\n", path)
+		return false
+	}
+	c.logf("No seed node available: using the last known topology from %s.\r\n", path)
+	return c.adoptTopology(topology)
+}
@@ -0,0 +1,45 @@
+package ovoclient
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+func TestRefreshFallsBackToSeeds(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	// every known node moved to another address
+	moved := &model.OvoTopology{Nodes: []*model.OvoTopologyNode{{Name: "old", Host: "127.0.0.1", Port: 1, HashRange: []int{}}}}
+	c.adoptTopology(moved)
+	c.checkCluster()
+	if topology := c.Topology(); len(topology.Nodes) != 2 {
+		t.Fatalf("topology not read from the seeds: %+v", topology)
+	}
+	if err := c.Put("key", "value", 0); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTopologyFile(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	path := filepath.Join(t.TempDir(), "topology.json")
+	config := fc.config()
+	config.TopologyFile = path
+	c := NewClientFromConfig(config)
+	c.Close()
+	// restart during a seed outage
+	restarted, err := NewClientFromConfigE(&Configuration{ClusterNodes: []Node{{Host: "127.0.0.1", Port: "1"}}, TopologyFile: path, StartupMode: StartupFailFast})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	if err := restarted.Put("key", "value", 0); err != nil {
+		t.Error(err)
+	}
+	if _, ok := fc.owner("key").value("key"); !ok {
+		t.Error("key not stored using the saved topology")
+	}
+}
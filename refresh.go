@@ -0,0 +1,73 @@
+package ovoclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultRefreshDebounce = Duration(500 * time.Millisecond)
+
+// The refresher reads the topology in background when the operations fail.
+// The requests are coalesced and the refreshes are spaced by the debounce period.
+type refresher struct {
+	mux     sync.Mutex
+	pending chan bool // closed when the next refresh is completed
+	signal  chan bool
+}
+
+func newRefresher() *refresher {
+	return &refresher{pending: make(chan bool), signal: make(chan bool, 1)}
+}
+
+// Ask a topology refresh; the returned channel is closed when the refresh is completed.
+func (c *Client) requestRefresh() <-chan bool {
+	c.refresher.mux.Lock()
+	done := c.refresher.pending
+	c.refresher.mux.Unlock()
+	select {
+	case c.refresher.signal <- true:
+	default:
+	}
+	return done
+}
+
+// Refresh the topology in background when requested.
+func (c *Client) refreshLoop() {
+	for {
+		select {
+		case <-c.refresher.signal:
+		case <-c.doneChan:
+			return
+		}
+		c.refresher.mux.Lock()
+		done := c.refresher.pending
+		c.refresher.pending = make(chan bool)
+		c.refresher.mux.Unlock()
+		c.checkCluster()
+		atomic.AddUint64(&c.metrics.topologyRefreshes, 1)
+		close(done)
+		select {
+		case <-time.After(time.Duration(c.getConfig().RefreshDebounce)):
+		case <-c.doneChan:
+			return
+		}
+	}
+}
+
+// Read the cluster topology again and wait until it is done or the context is done.
+func (c *Client) Refresh(ctx context.Context) error {
+	if err := c.begin(); err != nil {
+		return err
+	}
+	defer c.end()
+	select {
+	case <-c.requestRefresh():
+		return nil
+	case <-c.doneChan:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
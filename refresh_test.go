@@ -0,0 +1,47 @@
+package ovoclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRefreshDebounce(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.RefreshDebounce = Duration(200 * time.Millisecond)
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	for i := 0; i < 100; i++ {
+		c.requestRefresh()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Metrics().TopologyRefreshes; n < 1 || n > 2 {
+		t.Errorf("%d refreshes for 100 requests", n)
+	}
+}
+
+func TestRefreshContext(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.RefreshDebounce = Duration(time.Hour)
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the next refresh waits for the debounce period
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Refresh(ctx); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error %v", err)
+	}
+	c.Close()
+	if err := c.Refresh(context.Background()); err != ErrClientClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+}
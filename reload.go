@@ -0,0 +1,91 @@
+package ovoclient
+
+import (
+	"os"
+	"reflect"
+	"time"
+)
+
+// Watch the configuration file and reload it when it changes.
+// The file is polled every ReloadPeriod; the hot reload is disabled if the period is not set.
+// A reloaded configuration without ReloadPeriod keeps the current period.
+func (c *Client) watchConfig(path string) {
+	period := time.Duration(c.getConfig().ReloadPeriod)
+	if period <= 0 {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		c.logf("Configuration file %s not watched due to %v.\r\n", path, err)
+		return
+	}
+	go func() {
+		modTime, size := info.ModTime(), info.Size()
+		for {
+			select {
+			case <-time.After(period):
+			case <-c.doneChan:
+				return
+			}
+			info, err := os.Stat(path)
+			if err != nil || (info.ModTime().Equal(modTime) && info.Size() == size) {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			c.reloadConfig(path)
+			if p := time.Duration(c.getConfig().ReloadPeriod); p > 0 {
+				period = p
+			}
+		}
+	}()
+}
+
+// Load the configuration file again and apply it together with the options of New that follow the configuration file.
+// An invalid configuration is rejected with an EventConfigRejected event and the client keeps the current configuration.
+func (c *Client) reloadConfig(path string) error {
+	current := c.getConfig()
+	config, err := loadOverridden(path, current.overrides)
+	if err != nil {
+		c.logf("Configuration reload rejected: %v\r\n", err)
+		c.emit(Event{Type: EventConfigRejected, Err: err})
+		return err
+	}
+	// the options that can be set only in code are kept
+	config.Transport = current.Transport
+	config.Codec = current.Codec
+	config.Logger = current.Logger
+	config.StartupMode = current.StartupMode
+	config.Partitioner = current.Partitioner
+	config.EventHandler = current.EventHandler
+	config.Resolver = current.Resolver
+	config.configPath = current.configPath
+	setDefaults(config)
+	c.config.Store(config)
+	if config.ClusterCheckPeriod != current.ClusterCheckPeriod {
+		c.ticker.Reset(time.Duration(config.ClusterCheckPeriod))
+	}
+	if config.SeedDiscovery != current.SeedDiscovery {
+		c.discoverSeeds()
+	}
+	if !reflect.DeepEqual(config.ClusterNodes, current.ClusterNodes) || config.SeedDiscovery != current.SeedDiscovery {
+		c.requestRefresh()
+	}
+	c.logf("Configuration reloaded from %s.\r\n", path)
+	c.emit(Event{Type: EventConfigReloaded})
+	return nil
+}
+
+// Load the configuration file and apply the options to it.
+func loadOverridden(path string, overrides []Option) (*Configuration, error) {
+	config, err := LoadConfigurationE(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range overrides {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+	config.overrides = overrides
+	return config, config.Validate()
+}
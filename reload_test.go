@@ -0,0 +1,109 @@
+package ovoclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigReload(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	path := filepath.Join(t.TempDir(), "config.json")
+	seed := fmt.Sprintf(`{"Host":"127.0.0.1","Port":"%d"}`, fc.nodes[0].node.Port)
+	write := func(content string, age time.Duration) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(age)
+		os.Chtimes(path, mtime, mtime)
+	}
+	write(`{"ClusterNodes":[`+seed+`],"ReloadPeriod":"10ms"}`, -time.Hour)
+	events := make(chan Event, 10)
+	c, err := New(WithConfigFile(path), WithEventHandler(func(e Event) { events <- e }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	wait := func(expected EventType) Event {
+		for {
+			select {
+			case e := <-events:
+				if e.Type == expected {
+					return e
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("event %s not received", expected)
+			}
+		}
+	}
+	write(`{"ClusterNodes":[`+seed+`],"ReloadPeriod":"10ms","ReadRouting":"round-robin","HealthCheckPeriod":"1m"}`, -time.Minute)
+	wait(EventConfigReloaded)
+	config := c.getConfig()
+	if config.ReadRouting != RouteRoundRobin || config.HealthCheckPeriod != Duration(time.Minute) {
+		t.Errorf("configuration not applied: %+v", config)
+	}
+	if config.EventHandler == nil || config.Codec == nil {
+		t.Error("code options lost by the reload")
+	}
+	// an invalid edit is rejected and the client keeps the configuration
+	write(`{"ClusterNodes":[],"ReloadPeriod":"10ms"}`, 0)
+	if e := wait(EventConfigRejected); e.Err == nil {
+		t.Error("rejected configuration without error")
+	}
+	if c.getConfig() != config {
+		t.Error("invalid configuration applied")
+	}
+	if err := c.Put("key", "value", 0); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConfigReloadKeepsOptions(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	path := filepath.Join(t.TempDir(), "config.json")
+	seed := fmt.Sprintf(`{"Host":"127.0.0.1","Port":"%d"}`, fc.nodes[0].node.Port)
+	write := func(content string, age time.Duration) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(age)
+		os.Chtimes(path, mtime, mtime)
+	}
+	write(`{"ClusterNodes":[`+seed+`],"ReloadPeriod":"10ms"}`, -time.Hour)
+	events := make(chan Event, 10)
+	c, err := New(WithConfigFile(path), WithReadRouting(RouteRandom), WithWriteConsistency(Quorum), WithEventHandler(func(e Event) { events <- e }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	reloaded := func() {
+		for {
+			select {
+			case e := <-events:
+				if e.Type == EventConfigReloaded {
+					return
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("configuration not reloaded")
+			}
+		}
+	}
+	// the options of New take precedence over the file
+	write(`{"ClusterNodes":[`+seed+`],"ReloadPeriod":"10ms","ReadRouting":"round-robin","ReadRepair":true}`, -time.Minute)
+	reloaded()
+	config := c.getConfig()
+	if config.ReadRouting != RouteRandom || config.WriteConsistency != Quorum || !config.ReadRepair {
+		t.Errorf("unexpected configuration: %+v", config)
+	}
+	// without ReloadPeriod the file is still polled with the previous period
+	write(`{"ClusterNodes":[`+seed+`]}`, -time.Second)
+	reloaded()
+	write(`{"ClusterNodes":[`+seed+`],"HealthCheckPeriod":"1m"}`, 0)
+	reloaded()
+	if config := c.getConfig(); config.HealthCheckPeriod != Duration(time.Minute) || config.ReadRouting != RouteRandom {
+		t.Errorf("unexpected configuration: %+v", config)
+	}
+}
@@ -2,6 +2,7 @@ package ovoclient
 
 import(
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
@@ -51,6 +52,7 @@ type Request struct {
 	// Optional
 	Userinfo *url.Userinfo
 	Header   *http.Header
+	Context  context.Context // Cancels the request when done
 
 	// The following fields are populated by Send().
 	timestamp time.Time      // Time when HTTP request was sent
@@ -0,0 +1,119 @@
+package ovoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Routing policy of the reads among the primary node of a hash slot and its twins.
+// The writes are always sent to the primary node.
+type ReadRouting int
+
+const (
+	// The reads are sent to the primary node; the twins are used only when the primary fails.
+	RoutePrimary ReadRouting = iota
+	// The reads are sent in turn to the primary node and its twins.
+	RouteRoundRobin
+	// The reads are sent to a random replica.
+	RouteRandom
+	// The reads are sent to the replica with the lowest average latency.
+	RouteLeastLatency
+)
+
+func (r ReadRouting) String() string {
+	switch r {
+	case RoutePrimary:
+		return "primary"
+	case RouteRoundRobin:
+		return "round-robin"
+	case RouteRandom:
+		return "random"
+	case RouteLeastLatency:
+		return "least-latency"
+	}
+	return fmt.Sprintf("ReadRouting(%d)", int(r))
+}
+
+func (r ReadRouting) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *ReadRouting) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "primary", "":
+		*r = RoutePrimary
+	case "round-robin":
+		*r = RouteRoundRobin
+	case "random":
+		*r = RouteRandom
+	case "least-latency":
+		*r = RouteLeastLatency
+	default:
+		return errors.New("Invalid read routing " + string(b) + ".")
+	}
+	return nil
+}
+
+// Choose the replica that receives the first attempt of a read.
+// Only the alive and active replicas are eligible; the primary is chosen when no replica is eligible.
+func (c *Client) routeRead(s *Session, twins []*Session) *Session {
+	policy := c.getConfig().ReadRouting
+	if policy == RoutePrimary || len(twins) == 0 {
+		return s
+	}
+	replicas := make([]*Session, 0, len(twins)+1)
+	for _, st := range append([]*Session{s}, twins...) {
+		if c.health.isServing(st.Node().Name) {
+			replicas = append(replicas, st)
+		}
+	}
+	if len(replicas) == 0 {
+		return s
+	}
+	switch policy {
+	case RouteRoundRobin:
+		return replicas[int(atomic.AddUint64(&c.readTurn, 1)%uint64(len(replicas)))]
+	case RouteRandom:
+		return replicas[rand.Intn(len(replicas))]
+	case RouteLeastLatency:
+		// the replicas without samples are chosen first so that their latency is learned
+		best, bestLatency := replicas[0], time.Duration(-1)
+		for _, st := range replicas {
+			latency, ok := c.latency.average(st.Node().Name)
+			if !ok {
+				return st
+			}
+			if bestLatency < 0 || latency < bestLatency {
+				best, bestLatency = st, latency
+			}
+		}
+		return best
+	}
+	return s
+}
+
+// Send an operation to a node recording the latency of the successful requests.
+func (c *Client) timedOp(ctx context.Context, s *Session, op nodeOp) (*Response, error) {
+	start := time.Now()
+	rs, err := op(ctx, s)
+	if err == nil {
+		c.latency.record(s.Node().Name, time.Since(start))
+	}
+	return rs, err
+}
+
+// Remove a session from a list of sessions.
+func withoutSession(sessions []*Session, s *Session) []*Session {
+	others := make([]*Session, 0, len(sessions))
+	for _, st := range sessions {
+		if st != s {
+			others = append(others, st)
+		}
+	}
+	return others
+}
@@ -0,0 +1,132 @@
+package ovoclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReadRoutingRoundRobin(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.ReadRouting = RouteRoundRobin
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("balanced")
+	twin := fc.node(owner.node.Twins[0])
+	owner.store("balanced", []byte(`"value"`))
+	twin.store("balanced", []byte(`"value"`))
+	primaryStart, twinStart := owner.requestCount(), twin.requestCount()
+	var value string
+	for i := 0; i < 10; i++ {
+		if err := c.Get("balanced", &value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the counts include the health probes
+	if n := owner.requestCount() - primaryStart; n < 5 {
+		t.Errorf("primary received %d reads", n)
+	}
+	if n := twin.requestCount() - twinStart; n < 5 {
+		t.Errorf("twin received %d reads", n)
+	}
+	// the writes stay on the primary
+	if err := c.Put("written", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fc.owner("written").value("written"); !ok {
+		t.Error("write not sent to the primary")
+	}
+}
+
+func TestReadRoutingTwinMiss(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.ReadRouting = RouteRoundRobin
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("primary-only")
+	owner.store("primary-only", []byte(`"value"`))
+	// the twin does not have the value yet: the primary answers
+	for i := 0; i < 4; i++ {
+		var value string
+		if err := c.Get("primary-only", &value); err != nil || value != "value" {
+			t.Fatalf("Get returned %q, %v", value, err)
+		}
+	}
+}
+
+func TestReadRoutingLeastLatency(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.ReadRouting = RouteLeastLatency
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("fast")
+	twin := fc.node(owner.node.Twins[0])
+	owner.store("fast", []byte(`"value"`))
+	twin.store("fast", []byte(`"value"`))
+	owner.setDelay(30 * time.Millisecond)
+	var value string
+	for i := 0; i < 4; i++ {
+		c.Get("fast", &value)
+	}
+	primaryStart, twinStart := owner.requestCount(), twin.requestCount()
+	for i := 0; i < 10; i++ {
+		if err := c.Get("fast", &value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := twin.requestCount() - twinStart; n < 10 {
+		t.Errorf("fastest replica received %d of 10 reads", n)
+	}
+	if n := owner.requestCount() - primaryStart; n > 1 {
+		t.Errorf("slowest replica received %d reads", n)
+	}
+}
+
+func TestReadRoutingText(t *testing.T) {
+	for _, r := range []ReadRouting{RoutePrimary, RouteRoundRobin, RouteRandom, RouteLeastLatency} {
+		text, _ := r.MarshalText()
+		var parsed ReadRouting
+		if err := parsed.UnmarshalText(text); err != nil || parsed != r {
+			t.Errorf("%s parsed as %s, %v", text, parsed, err)
+		}
+	}
+	var r ReadRouting
+	if err := r.UnmarshalText([]byte("nearest")); err == nil {
+		t.Error("invalid read routing accepted")
+	}
+}
+
+func TestReadRoutingLeastLatencyRecovery(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	config := fc.config()
+	config.ReadRouting = RouteLeastLatency
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	owner := fc.owner("recover")
+	twin := fc.node(owner.node.Twins[0])
+	owner.store("recover", []byte(`"value"`))
+	twin.store("recover", []byte(`"value"`))
+	twin.setDelay(30 * time.Millisecond)
+	var value string
+	for i := 0; i < 4; i++ {
+		c.Get("recover", &value)
+	}
+	// the twin recovers and the primary slows down: only the probes measure the twin again
+	twin.setDelay(0)
+	owner.setDelay(10 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		c.probeNodes(context.Background())
+	}
+	twinStart := twin.requestCount()
+	for i := 0; i < 5; i++ {
+		if err := c.Get("recover", &value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := twin.requestCount() - twinStart; n < 5 {
+		t.Errorf("recovered replica received %d of 5 reads", n)
+	}
+}
@@ -1,6 +1,7 @@
 package ovoclient
 
 import (
+	"context"
 	"strconv"
 	"bytes"
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 	"github.com/maxzerbini/ovoclient/model"
 )
@@ -23,22 +25,66 @@ type Session struct {
 	Header *http.Header
 	Params *url.Values
 	// Ovo Node 
-	node *model.OvoTopologyNode
+	state *sessionState
 	port string
+	// context of the requests
+	ctx context.Context
+}
+
+// State of a session shared by its copies.
+type sessionState struct {
+	node         atomic.Pointer[model.OvoTopologyNode]
+	active       int64 // requests in progress
+	ownTransport bool  // the transport is not shared with other sessions
 }
 
 // create a new Session
 func NewSession() *Session {
-	return &Session{Client:&http.Client{}}
+	return &Session{Client:&http.Client{}, state:&sessionState{}}
 }
 
 func (s *Session) SetNode(node *model.OvoTopologyNode){
-	s.node = node
+	if s.state == nil {
+		s.state = &sessionState{}
+	}
+	s.state.node.Store(node)
 	s.port = strconv.Itoa(node.Port)
 }
 
+// Node returns the OVO node of the session.
+func (s *Session) Node() *model.OvoTopologyNode {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.node.Load()
+}
+
+// Update the metadata of the node; the host and the port must not change.
+func (s *Session) updateNode(node *model.OvoTopologyNode) {
+	s.state.node.Store(node)
+}
+
+// Get the number of requests in progress.
+func (s *Session) activeRequests() int64 {
+	if s.state == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.state.active)
+}
+
+// WithContext returns a copy of the session whose requests are bound to the context.
+func (s *Session) WithContext(ctx context.Context) *Session {
+	sc := *s
+	sc.ctx = ctx
+	return &sc
+}
+
 // Send constructs and sends an HTTP request.
 func (s *Session) Send(r *Request) (response *Response, err error) {
+	if s.state != nil {
+		atomic.AddInt64(&s.state.active, 1)
+		defer atomic.AddInt64(&s.state.active, -1)
+	}
 	r.Method = strings.ToUpper(r.Method)
 	//
 	// Create a URL object from the raw url string.  This will allow us to compose
@@ -146,6 +192,12 @@ func (s *Session) Send(r *Request) (response *Response, err error) {
 		header.Add("Accept", "application/json") // Default, can be overridden with Opts
 	}
 	req.Header = header
+	if r.Context == nil {
+		r.Context = s.ctx
+	}
+	if r.Context != nil {
+		req = req.WithContext(r.Context)
+	}
 	r.timestamp = time.Now()
 	var client *http.Client
 	if s.Client != nil {
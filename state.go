@@ -0,0 +1,121 @@
+package ovoclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+const defaultInactiveWriteTimeout = Duration(5 * time.Second)
+
+// ErrNodeInactive is returned when a write is sent to a primary node marked as inactive by the cluster and the policy rejects it.
+var ErrNodeInactive = errors.New("Node inactive.")
+
+// Policy of the writes whose primary node is marked as inactive by the cluster.
+type InactiveWritePolicy int
+
+const (
+	// The write is sent to the active twins of the primary node, like after a failure of the primary.
+	InactiveWriteRedirect InactiveWritePolicy = iota
+	// The write waits until the primary node is active again, at most InactiveWriteTimeout.
+	InactiveWriteQueue
+	// The write fails with ErrNodeInactive.
+	InactiveWriteReject
+)
+
+func (p InactiveWritePolicy) String() string {
+	switch p {
+	case InactiveWriteRedirect:
+		return "redirect"
+	case InactiveWriteQueue:
+		return "queue"
+	case InactiveWriteReject:
+		return "reject"
+	}
+	return fmt.Sprintf("InactiveWritePolicy(%d)", int(p))
+}
+
+func (p InactiveWritePolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *InactiveWritePolicy) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "redirect", "":
+		*p = InactiveWriteRedirect
+	case "queue":
+		*p = InactiveWriteQueue
+	case "reject":
+		*p = InactiveWriteReject
+	default:
+		return errors.New("Invalid inactive write policy " + string(b) + ".")
+	}
+	return nil
+}
+
+// Record the state of a node reported by the cluster, counting and notifying the transitions.
+func (c *Client) observeState(node *model.OvoTopologyNode, state string) {
+	if state == "" || !c.health.setState(node, state) {
+		return
+	}
+	if state == model.Inactive {
+		atomic.AddUint64(&c.metrics.nodeDeactivations, 1)
+	} else {
+		atomic.AddUint64(&c.metrics.nodeActivations, 1)
+	}
+	c.logf("Node %s is %s.\r\n", node.Name, state)
+	c.emit(Event{Type: EventNodeStateChanged, Node: node.Name, State: state})
+}
+
+// Apply the inactive write policy to a write whose primary node is inactive.
+// With the queue policy it waits until the node is active again; it returns ErrNodeInactive if the write must fail.
+func (c *Client) inactiveWrite(s *Session) error {
+	switch c.getConfig().InactiveWrites {
+	case InactiveWriteReject:
+		return ErrNodeInactive
+	case InactiveWriteQueue:
+		timeout := time.After(time.Duration(c.getConfig().InactiveWriteTimeout))
+		for !c.health.isActive(s.Node().Name) {
+			// the refreshes are debounced by the refresher
+			c.requestRefresh()
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-timeout:
+				return ErrNodeInactive
+			case <-c.doneChan:
+				return ErrClientClosed
+			}
+		}
+	}
+	return nil
+}
+
+// Order the sessions putting first the alive and active nodes; the slice is returned as it is if it is already ordered.
+func (c *Client) servingFirst(sessions []*Session) []*Session {
+	serving := make([]bool, len(sessions))
+	ordered, idle := true, false
+	for i, s := range sessions {
+		serving[i] = c.health.isServing(s.Node().Name)
+		ordered = ordered && !(serving[i] && idle)
+		idle = idle || !serving[i]
+	}
+	if ordered {
+		return sessions
+	}
+	result := make([]*Session, 0, len(sessions))
+	for i, s := range sessions {
+		if serving[i] {
+			result = append(result, s)
+		}
+	}
+	for i, s := range sessions {
+		if !serving[i] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package ovoclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+func TestInactiveNodeRouting(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	owner := fc.owner("inactive")
+	twin := fc.node(owner.node.Twins[0])
+	owner.setState(model.Inactive)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	// the reads skip the inactive primary
+	twin.store("inactive", []byte(`"twin"`))
+	owner.store("inactive", []byte(`"primary"`))
+	var value string
+	if err := c.Get("inactive", &value); err != nil || value != "twin" {
+		t.Fatalf("Get returned %q, %v", value, err)
+	}
+	// the writes are redirected to the twin by default
+	if err := c.Put("inactive", "written", 0); !IsDurable(err) {
+		t.Fatal(err)
+	}
+	if data, _ := twin.value("inactive"); string(data) != `"written"` {
+		t.Errorf("write not redirected to the twin: %s", data)
+	}
+	if data, _ := owner.value("inactive"); string(data) != `"primary"` {
+		t.Errorf("write sent to the inactive primary: %s", data)
+	}
+}
+
+func TestInactiveWriteReject(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	owner := fc.owner("rejected")
+	owner.setState(model.Inactive)
+	config := fc.config()
+	config.InactiveWrites = InactiveWriteReject
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	if err := c.Put("rejected", "value", 0); err != ErrNodeInactive {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestInactiveWriteQueue(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	owner := fc.owner("queued")
+	owner.setState(model.Inactive)
+	config := fc.config()
+	config.InactiveWrites = InactiveWriteQueue
+	config.InactiveWriteTimeout = Duration(100 * time.Millisecond)
+	config.RefreshDebounce = Duration(10 * time.Millisecond)
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	if err := c.Put("queued", "value", 0); err != ErrNodeInactive {
+		t.Errorf("unexpected error %v", err)
+	}
+	// the write waits until the node is active again
+	longer := *c.getConfig()
+	longer.InactiveWriteTimeout = Duration(5 * time.Second)
+	c.config.Store(&longer)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		owner.setState(model.Active)
+	}()
+	if err := c.Put("queued", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := owner.value("queued"); !ok {
+		t.Error("queued write not sent to the primary")
+	}
+}
+
+func TestNodeStateMetrics(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	var mux sync.Mutex
+	events := make([]Event, 0)
+	config := fc.config()
+	config.RefreshDebounce = Duration(time.Millisecond)
+	config.EventHandler = func(e Event) {
+		if e.Type == EventNodeStateChanged {
+			mux.Lock()
+			events = append(events, e)
+			mux.Unlock()
+		}
+	}
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	fc.nodes[1].setState(model.Inactive)
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fc.nodes[1].setState(model.Active)
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if m := c.Metrics(); m.NodeDeactivations != 1 || m.NodeActivations != 1 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if len(events) != 2 || events[0].Node != "node1" || events[0].State != model.Inactive || events[1].State != model.Active {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
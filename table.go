@@ -0,0 +1,122 @@
+package ovoclient
+
+import (
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+const sessionDrainTimeout = 10 * time.Second // maximum wait for the requests in progress on a removed node
+
+// Routing table of the client: an immutable snapshot of the topology and of the node sessions.
+// A new table is built on every topology change and published atomically, so the operations read it without locks.
+type routingTable struct {
+	topology    *model.OvoTopology    // nil if the topology was not read yet
+	partitioner Partitioner           // mapping of the keys on the hash slots
+	slots       []*Session            // session of the node serving every hash slot, nil if no node serves the slot
+	sessions    map[string]*Session   // sessions by node name
+	twins       map[string][]*Session // sessions of the twins by node name
+}
+
+// Build the routing table of a topology; a nil topology gives an empty table.
+// The sessions of the previous table are reused for the nodes whose address did not change and their node metadata is updated;
+// the sessions of the removed nodes are returned so that they can be retired.
+func (c *Client) newRoutingTable(topology *model.OvoTopology, previous *routingTable) (*routingTable, []*Session) {
+	if previous == nil {
+		previous = &routingTable{}
+	}
+	t := &routingTable{topology: topology, partitioner: c.getConfig().Partitioner, sessions: make(map[string]*Session), twins: make(map[string][]*Session)}
+	if t.partitioner == nil {
+		// the number of slots is not derived from the topology, so that a wrong hash range does not change the hash of the keys
+		t.partitioner = HashPartitioner{}
+	}
+	t.slots = make([]*Session, t.partitioner.SlotCount())
+	if topology == nil {
+		return t, nil
+	}
+	for _, node := range topology.Nodes {
+		s, ok := previous.sessions[node.Name]
+		if ok && s.Node().Host == node.Host && s.Node().Port == node.Port {
+			s.updateNode(node)
+		} else {
+			s = c.newNodeSession(node)
+		}
+		for _, hash := range node.HashRange {
+			if hash >= 0 && hash < len(t.slots) {
+				t.slots[hash] = s
+			}
+		}
+		t.sessions[node.Name] = s
+	}
+	for _, node := range topology.Nodes {
+		twins := make([]*Session, 0, len(node.Twins))
+		for _, nd := range topology.GetTwins(node.Twins) {
+			twins = append(twins, t.sessions[nd.Name])
+		}
+		t.twins[node.Name] = twins
+	}
+	removed := make([]*Session, 0)
+	for name, s := range previous.sessions {
+		if t.sessions[name] != s {
+			removed = append(removed, s)
+		}
+	}
+	return t, removed
+}
+
+// Publish the routing table of a topology and retire the sessions of the removed nodes.
+func (c *Client) publishTopology(topology *model.OvoTopology) {
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+	t, removed := c.newRoutingTable(topology, c.routes())
+	c.table.Store(t)
+	if topology != nil {
+		for _, node := range topology.Nodes {
+			c.observeState(node, node.State)
+		}
+		c.dropHints(topology)
+		c.saveTopology(topology)
+	}
+	for _, s := range removed {
+		c.logf("Node %s removed from the topology.\r\n", s.Node().Name)
+		c.retire(s)
+	}
+}
+
+// Close the idle connections of a removed session after its requests in progress are completed;
+// a transport shared with the other nodes is left open.
+func (c *Client) retire(s *Session) {
+	go func() {
+		defer func() {
+			if s.state.ownTransport {
+				s.Client.CloseIdleConnections()
+			}
+		}()
+		deadline := time.Now().Add(sessionDrainTimeout)
+		for s.activeRequests() > 0 && time.Now().Before(deadline) {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-c.doneChan:
+				return
+			}
+		}
+	}()
+}
+
+// Get the session of the node serving the hash slot, nil if no node serves it.
+func (t *routingTable) session(hash int32) *Session {
+	if hash < 0 || int(hash) >= len(t.slots) {
+		return nil
+	}
+	return t.slots[hash]
+}
+
+// Get the sessions of the twin nodes.
+func (t *routingTable) twinSessions(s *Session) []*Session {
+	return t.twins[s.Node().Name]
+}
+
+// Get the current routing table.
+func (c *Client) routes() *routingTable {
+	return c.table.Load()
+}
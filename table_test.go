@@ -0,0 +1,149 @@
+package ovoclient
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+func TestRoutingTableConcurrentRefresh(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				c.checkCluster()
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var value string
+			for j := 0; j < 20; j++ {
+				if err := c.Put("key", "value", 0); err != nil {
+					t.Error(err)
+				}
+				c.Get("key", &value)
+				c.Count()
+				c.Keys()
+				c.Health()
+				c.SlotMap()
+				c.Locate("key")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRoutingTable(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := &Client{transport: &http.Transport{}}
+	c.config.Store(fc.config())
+	empty, _ := c.newRoutingTable(nil, nil)
+	if empty.topology != nil || empty.session(0) != nil || len(empty.slots) != int(empty.partitioner.SlotCount()) {
+		t.Error("unexpected empty table")
+	}
+	table, _ := c.newRoutingTable(&fc.topology, nil)
+	for hash, s := range table.slots {
+		if s == nil {
+			t.Fatalf("slot %d not served", hash)
+		}
+		twins := table.twinSessions(s)
+		if len(twins) != 1 || twins[0] != table.sessions[s.Node().Twins[0]] {
+			t.Errorf("unexpected twins of %s", s.Node().Name)
+		}
+	}
+	if table.session(-1) != nil || table.session(int32(len(table.slots))) != nil {
+		t.Error("session of a slot out of range")
+	}
+}
+
+func TestRoutingTableReconciliation(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := &Client{transport: &http.Transport{}}
+	c.config.Store(fc.config())
+	previous, _ := c.newRoutingTable(&fc.topology, nil)
+	next := &model.OvoTopology{}
+	for _, node := range fc.topology.Nodes[:2] {
+		nd := *node
+		next.Nodes = append(next.Nodes, &nd)
+	}
+	next.Nodes[0].State = model.Inactive
+	next.Nodes[0].HashRange = append(next.Nodes[0].HashRange, fc.topology.Nodes[2].HashRange...)
+	next.Nodes[1].Port++
+	next.Nodes[1].Twins = []string{next.Nodes[0].Name}
+	table, removed := c.newRoutingTable(next, previous)
+	name0, name1, name2 := next.Nodes[0].Name, next.Nodes[1].Name, fc.topology.Nodes[2].Name
+	if s := table.sessions[name0]; s != previous.sessions[name0] || s.Node().State != model.Inactive {
+		t.Error("session of the unchanged node not reused or not updated")
+	}
+	if table.sessions[name1] == previous.sessions[name1] || table.sessions[name1].port != strconv.Itoa(next.Nodes[1].Port) {
+		t.Error("session of the moved node reused")
+	}
+	if len(removed) != 2 {
+		t.Fatalf("%d sessions removed", len(removed))
+	}
+	for _, s := range removed {
+		if s != previous.sessions[name1] && s != previous.sessions[name2] {
+			t.Errorf("session of %s removed", s.Node().Name)
+		}
+	}
+	if table.session(int32(fc.topology.Nodes[2].HashRange[0])) != table.sessions[name0] {
+		t.Error("slot of the removed node not moved")
+	}
+}
+
+func TestRefreshReusesSessions(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	before := c.routes().sessions
+	c.checkCluster()
+	after := c.routes().sessions
+	for name, s := range before {
+		if after[name] != s {
+			t.Errorf("session of %s not reused", name)
+		}
+	}
+}
+
+func TestRetireKeepsOtherConnections(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	kept, removed := fc.nodes[0], fc.nodes[1]
+	key := ownedKeys(fc, kept, 1)[0]
+	if err := c.Put(key, "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ownedKeys(fc, removed, 1)[0], "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	opened, _ := kept.connCount()
+	c.publishTopology(&model.OvoTopology{Nodes: fc.topology.Nodes[:1]})
+	retired := func() bool {
+		_, closed := removed.connCount()
+		return closed > 0
+	}
+	if !waitFor(t, 2*time.Second, retired) {
+		t.Fatal("connections of the removed node not closed")
+	}
+	// the connection of the surviving node is reused
+	var value string
+	if err := c.Get(key, &value); err != nil {
+		t.Fatal(err)
+	}
+	if now, closed := kept.connCount(); now != opened || closed != 0 {
+		t.Errorf("%d connections opened and %d closed on the surviving node, %d expected", now, closed, opened)
+	}
+}
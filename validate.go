@@ -0,0 +1,145 @@
+package ovoclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// Kind of a topology issue.
+type TopologyIssueKind int
+
+const (
+	// No node serves the hash slot.
+	UncoveredSlot TopologyIssueKind = iota
+	// More than one node serves the hash slot.
+	DuplicatedSlot
+	// The twin of a node is not in the topology.
+	UnknownTwin
+	// The twin of a node runs on the same host of the node.
+	TwinOnSameHost
+	// A node serves a hash slot that is negative or not lower than the number of slots.
+	InvalidSlot
+)
+
+func (k TopologyIssueKind) String() string {
+	switch k {
+	case UncoveredSlot:
+		return "uncovered slot"
+	case DuplicatedSlot:
+		return "duplicated slot"
+	case UnknownTwin:
+		return "unknown twin"
+	case TwinOnSameHost:
+		return "twin on the same host"
+	case InvalidSlot:
+		return "invalid slot"
+	}
+	return fmt.Sprintf("TopologyIssueKind(%d)", int(k))
+}
+
+// An issue found in a topology.
+type TopologyIssue struct {
+	Kind  TopologyIssueKind
+	Slot  int32    // hash slot of UncoveredSlot, DuplicatedSlot and InvalidSlot
+	Nodes []string // nodes serving the duplicated or invalid slot, or the node and its twin
+}
+
+// Check if the issue makes the routing of some keys wrong; a twin on the same host only reduces the availability.
+func (i TopologyIssue) Fatal() bool {
+	return i.Kind != TwinOnSameHost
+}
+
+func (i TopologyIssue) String() string {
+	switch i.Kind {
+	case UncoveredSlot:
+		return fmt.Sprintf("%s %d", i.Kind, i.Slot)
+	case DuplicatedSlot, InvalidSlot:
+		return fmt.Sprintf("%s %d (%s)", i.Kind, i.Slot, strings.Join(i.Nodes, ", "))
+	}
+	return fmt.Sprintf("%s %s", i.Kind, strings.Join(i.Nodes, " -> "))
+}
+
+// A TopologyError reports the issues of an invalid topology.
+type TopologyError struct {
+	Issues []TopologyIssue
+}
+
+func (e *TopologyError) Error() string {
+	issues := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		issues = append(issues, issue.String())
+	}
+	return "Invalid topology: " + strings.Join(issues, "; ") + "."
+}
+
+// Check if at least one issue is fatal.
+func (e *TopologyError) Fatal() bool {
+	for _, issue := range e.Issues {
+		if issue.Fatal() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that every hash slot is served by exactly one node, that the nodes serve only the slots from 0 to slotCount-1
+// and that the twins are known nodes running on other hosts.
+// It returns nil if the topology is valid, otherwise a *TopologyError.
+func ValidateTopology(topology *model.OvoTopology, slotCount int32) error {
+	issues := make([]TopologyIssue, 0)
+	owners := make([][]string, slotCount)
+	nodes := make(map[string]*model.OvoTopologyNode, len(topology.Nodes))
+	for _, node := range topology.Nodes {
+		nodes[node.Name] = node
+		for _, hash := range node.HashRange {
+			if hash >= 0 && hash < int(slotCount) {
+				owners[hash] = append(owners[hash], node.Name)
+			} else {
+				issues = append(issues, TopologyIssue{Kind: InvalidSlot, Slot: int32(hash), Nodes: []string{node.Name}})
+			}
+		}
+	}
+	for hash, names := range owners {
+		if len(names) == 0 {
+			issues = append(issues, TopologyIssue{Kind: UncoveredSlot, Slot: int32(hash)})
+		} else if len(names) > 1 {
+			issues = append(issues, TopologyIssue{Kind: DuplicatedSlot, Slot: int32(hash), Nodes: names})
+		}
+	}
+	for _, node := range topology.Nodes {
+		for _, name := range node.Twins {
+			twin, ok := nodes[name]
+			if !ok {
+				issues = append(issues, TopologyIssue{Kind: UnknownTwin, Nodes: []string{node.Name, name}})
+			} else if twin.Host == node.Host {
+				issues = append(issues, TopologyIssue{Kind: TwinOnSameHost, Nodes: []string{node.Name, name}})
+			}
+		}
+	}
+	if len(issues) > 0 {
+		return &TopologyError{Issues: issues}
+	}
+	return nil
+}
+
+// Validate a topology read from the cluster and adopt it.
+// The issues are logged and sent to the event handler; with RejectInvalidTopology a topology with fatal issues is not adopted.
+func (c *Client) adoptTopology(topology *model.OvoTopology) bool {
+	config := c.getConfig()
+	slotCount := (HashPartitioner{}).SlotCount()
+	if config.Partitioner != nil {
+		slotCount = config.Partitioner.SlotCount()
+	}
+	if err := ValidateTopology(topology, slotCount); err != nil {
+		c.logf("%v\r\n", err)
+		c.emit(Event{Type: EventInvalidTopology, Err: err})
+		if config.RejectInvalidTopology && err.(*TopologyError).Fatal() {
+			c.logf("Topology refused.\r\n")
+			return false
+		}
+	}
+	c.publishTopology(topology)
+	return true
+}
@@ -0,0 +1,72 @@
+package ovoclient
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+func TestValidateTopology(t *testing.T) {
+	topology := &model.OvoTopology{Nodes: []*model.OvoTopologyNode{
+		{Name: "a", Host: "host1", HashRange: []int{0, 1}, Twins: []string{"b", "x"}},
+		{Name: "b", Host: "host1", HashRange: []int{1, 3}, Twins: []string{"a"}},
+	}}
+	err := ValidateTopology(topology, 4)
+	terr, ok := err.(*TopologyError)
+	if !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	kinds := make(map[TopologyIssueKind]int)
+	for _, issue := range terr.Issues {
+		kinds[issue.Kind]++
+	}
+	if kinds[UncoveredSlot] != 1 || kinds[DuplicatedSlot] != 1 || kinds[UnknownTwin] != 1 || kinds[TwinOnSameHost] != 2 {
+		t.Errorf("unexpected issues %v", terr)
+	}
+	if !terr.Fatal() {
+		t.Error("uncovered slots must be fatal")
+	}
+	// the slots out of range do not change the number of slots
+	topology.Nodes[1].HashRange = []int{-1, 2, 3, 200}
+	err = ValidateTopology(topology, 4)
+	if terr, ok := err.(*TopologyError); !ok || !terr.Fatal() || len(terr.Issues) != 5 || terr.Issues[0].Kind != InvalidSlot || terr.Issues[0].Slot != -1 || terr.Issues[1].Slot != 200 {
+		t.Errorf("unexpected issues %v", err)
+	}
+	topology.Nodes[1].HashRange = []int{2, 3}
+	topology.Nodes[0].Twins = []string{"b"}
+	if err := ValidateTopology(topology, 4); err == nil || err.(*TopologyError).Fatal() {
+		t.Errorf("only the twins on the same host expected: %v", err)
+	}
+	topology.Nodes[1].Host = "host2"
+	if err := ValidateTopology(topology, 4); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRejectInvalidTopology(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	fc.nodes[0].node.HashRange = fc.nodes[0].node.HashRange[1:]
+	var mux sync.Mutex
+	events := make([]Event, 0)
+	config := fc.config()
+	config.RejectInvalidTopology = true
+	config.EventHandler = func(e Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		events = append(events, e)
+	}
+	c := NewClientFromConfig(config)
+	defer c.Close()
+	if err := c.Put("key", "value", 0); err != ErrNoTopology {
+		t.Errorf("invalid topology adopted: %v", err)
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if len(events) == 0 || events[0].Type != EventInvalidTopology {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if _, ok := events[0].Err.(*TopologyError); !ok {
+		t.Errorf("unexpected error %v", events[0].Err)
+	}
+}
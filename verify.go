@@ -0,0 +1,381 @@
+package ovoclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/maxzerbini/ovoclient/model"
+)
+
+// Kind of a replica issue.
+type ReplicaIssueKind int
+
+const (
+	// The replica does not store the key stored by the primary node, or the primary does not store the key stored by a twin.
+	ReplicaMissing ReplicaIssueKind = iota
+	// The replica stores a value different from the value of the primary node.
+	ReplicaDivergent
+	// The replica could not be read.
+	ReplicaUnreachable
+)
+
+func (k ReplicaIssueKind) String() string {
+	switch k {
+	case ReplicaMissing:
+		return "missing"
+	case ReplicaDivergent:
+		return "divergent"
+	case ReplicaUnreachable:
+		return "unreachable"
+	}
+	return fmt.Sprintf("ReplicaIssueKind(%d)", int(k))
+}
+
+func (k ReplicaIssueKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Options of VerifyReplicas.
+type VerifyOptions struct {
+	Prefix      string   // verify only the keys starting with the prefix
+	Slots       []int32  // verify only the keys of the hash slots, all the slots if empty
+	Counters    []string // counters to verify
+	Repair      bool     // write the value of the primary node on the missing and divergent twins
+	Concurrency int      // number of keys verified concurrently, 1 if not set
+}
+
+// An issue of a replica of a key.
+type ReplicaIssue struct {
+	Key      string
+	Counter  bool // the key is a counter
+	Slot     int32
+	Node     string
+	Primary  bool // the replica is the primary node
+	Kind     ReplicaIssueKind
+	Err      string `json:",omitempty"` // error of the unreachable replicas and of the failed repairs
+	Repaired bool
+}
+
+// A node whose keys could not be listed.
+type UnlistedNode struct {
+	Node string
+	Err  string
+}
+
+// A key stored on a node that neither owns nor replicates its hash slot.
+type OrphanKey struct {
+	Key  string
+	Slot int32
+	Node string
+}
+
+// Report of VerifyReplicas.
+type VerifyReport struct {
+	Keys       int // keys and counters verified
+	Consistent int // keys and counters with the same value on all the replicas
+	Repaired   int // replicas repaired
+	Issues     []ReplicaIssue
+	Orphans    []OrphanKey
+	Unlisted   []UnlistedNode // nodes whose keys could not be listed; their keys are verified only if a twin stores them
+}
+
+// Verify the replicas of the keys: the keys of every node are listed and each key is read, by hash slot,
+// from its primary node and all its twins.
+// The report lists the missing and divergent replicas, the orphan keys stored on nodes that neither own nor replicate their slot
+// and the nodes whose keys could not be listed, e.g. a replaced node that is not reachable yet.
+// With opts.Repair the value of the primary node is written on the lagging twins; a key missing on the primary node is only reported,
+// because it can be a delete missed by the twins. Like the read repair, the repaired values do not expire.
+func (c *Client) VerifyReplicas(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	if err := c.begin(); err != nil {
+		return nil, err
+	}
+	defer c.end()
+	t := c.routes()
+	if t.topology == nil {
+		return nil, ErrNoTopology
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	slots := make(map[int32]bool)
+	for _, slot := range opts.Slots {
+		slots[slot] = true
+	}
+	report := &VerifyReport{Issues: make([]ReplicaIssue, 0), Orphans: make([]OrphanKey, 0), Unlisted: make([]UnlistedNode, 0)}
+	holders, failed := c.listKeys(ctx, t)
+	for _, node := range t.topology.Nodes {
+		if err, ok := failed[node.Name]; ok {
+			report.Unlisted = append(report.Unlisted, UnlistedNode{Node: node.Name, Err: err.Error()})
+		}
+	}
+	keys := make([]string, 0, len(holders))
+	hashes := make(map[string]int32, len(holders))
+	for key := range holders {
+		hashes[key] = t.partitioner.Slot(key)
+		if strings.HasPrefix(key, opts.Prefix) && (len(slots) == 0 || slots[hashes[key]]) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if hashes[keys[i]] != hashes[keys[j]] {
+			return hashes[keys[i]] < hashes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		s := t.session(hashes[key])
+		for _, name := range holders[key] {
+			if s == nil || !isReplica(t, s, name) {
+				report.Orphans = append(report.Orphans, OrphanKey{Key: key, Slot: hashes[key], Node: name})
+			}
+		}
+	}
+	type job struct {
+		key     string
+		counter bool
+	}
+	var mux sync.Mutex
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				issues, verified := c.verifyKey(ctx, t, j.key, j.counter, opts.Repair)
+				mux.Lock()
+				if verified {
+					report.Keys++
+					if len(issues) == 0 {
+						report.Consistent++
+					}
+				}
+				for _, issue := range issues {
+					if issue.Repaired {
+						report.Repaired++
+					}
+				}
+				report.Issues = append(report.Issues, issues...)
+				mux.Unlock()
+			}
+		}()
+	}
+	var err error
+	send := func(j job) bool {
+		select {
+		case jobs <- j:
+			return true
+		case <-ctx.Done():
+			err = ctx.Err()
+			return false
+		}
+	}
+	for _, key := range keys {
+		if !send(job{key: key}) {
+			break
+		}
+	}
+	for _, key := range opts.Counters {
+		if err != nil || !send(job{key: key, counter: true}) {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	sort.SliceStable(report.Issues, func(i, j int) bool { return report.Issues[i].Slot < report.Issues[j].Slot })
+	return report, err
+}
+
+// Check if the node is the primary node or a twin of the session.
+func isReplica(t *routingTable, s *Session, name string) bool {
+	if s.Node().Name == name {
+		return true
+	}
+	for _, st := range t.twinSessions(s) {
+		if st.Node().Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// List the keys of every node of the topology; it returns the nodes storing every key and the errors of the nodes whose keys could not be listed.
+func (c *Client) listKeys(ctx context.Context, t *routingTable) (map[string][]string, map[string]error) {
+	holders := make(map[string][]string)
+	failed := make(map[string]error)
+	for _, node := range t.topology.Nodes {
+		keys, err := c.nodeKeys(ctx, t.sessions[node.Name])
+		if err != nil {
+			failed[node.Name] = err
+			continue
+		}
+		for _, key := range keys {
+			holders[key] = append(holders[key], node.Name)
+		}
+	}
+	return holders, failed
+}
+
+// List the keys of all the nodes in lexical order; it fails if the keys of a node could not be listed.
+func (c *Client) allKeys(ctx context.Context) ([]string, error) {
+	t := c.routes()
+	if t.topology == nil {
+		return nil, ErrNoTopology
+	}
+	holders, failed := c.listKeys(ctx, t)
+	for _, node := range t.topology.Nodes {
+		if err, ok := failed[node.Name]; ok {
+			return nil, fmt.Errorf("keys of node %s not listed: %v", node.Name, err)
+		}
+	}
+	keys := make([]string, 0, len(holders))
+	for key := range holders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Get the keys stored on a node.
+func (c *Client) nodeKeys(ctx context.Context, s *Session) ([]string, error) {
+	resp := &model.OvoResponse{Data: &model.OvoKVKeys{}}
+	rs, err := s.WithContext(ctx).Get(createKeysEndpoint(s.Node().Host, s.port), nil, resp, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rs.status != 200 {
+		return nil, fmt.Errorf("status %d", rs.status)
+	}
+	return resp.Data.(*model.OvoKVKeys).Keys, nil
+}
+
+// Value of a key on a replica.
+type replicaValue struct {
+	session *Session
+	data    []byte // value of a key
+	value   int64  // value of a counter
+	found   bool
+	err     error
+}
+
+// Check if the replica stores the same value of another replica.
+func (v replicaValue) equal(o replicaValue) bool {
+	return bytes.Equal(v.data, o.data) && v.value == o.value
+}
+
+// Read the value of a key or a counter from a replica.
+func (c *Client) replicaValue(ctx context.Context, s *Session, key string, counter bool) replicaValue {
+	v := replicaValue{session: s}
+	if counter {
+		resp := &model.OvoCounterResponse{}
+		rs, err := s.WithContext(ctx).Get(createCounterEndpoint(s.Node().Host, s.port, key), nil, resp, nil)
+		if v.err = err; err == nil {
+			v.found, v.err = statusFound(rs)
+			v.value = resp.Data.Value
+		}
+		return v
+	}
+	resp := &model.OvoResponse{Data: &model.OvoKVResponse{}}
+	rs, err := s.WithContext(ctx).Get(createGetKeyStorageEndpoint(s.Node().Host, s.port, key), nil, resp, nil)
+	if v.err = err; err == nil {
+		if v.found, v.err = statusFound(rs); v.found {
+			v.data = kvData(rs)
+		}
+	}
+	return v
+}
+
+// Check if a read response found the key.
+func statusFound(rs *Response) (bool, error) {
+	switch rs.status {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	}
+	return false, fmt.Errorf("status %d", rs.status)
+}
+
+// Verify the replicas of a key and repair the lagging twins; false if the key is not stored anymore or its primary is unreachable.
+func (c *Client) verifyKey(ctx context.Context, t *routingTable, key string, counter bool, repair bool) ([]ReplicaIssue, bool) {
+	hash := t.partitioner.Slot(key)
+	s := t.session(hash)
+	if s == nil {
+		return nil, false
+	}
+	issues := make([]ReplicaIssue, 0)
+	issue := func(v replicaValue, kind ReplicaIssueKind) *ReplicaIssue {
+		i := ReplicaIssue{Key: key, Counter: counter, Slot: hash, Node: v.session.Node().Name, Primary: v.session == s, Kind: kind}
+		if v.err != nil {
+			i.Err = v.err.Error()
+		}
+		issues = append(issues, i)
+		return &issues[len(issues)-1]
+	}
+	primary := c.replicaValue(ctx, s, key, counter)
+	if primary.err != nil {
+		issue(primary, ReplicaUnreachable)
+		return issues, false
+	}
+	twins := make([]replicaValue, 0)
+	for _, st := range t.twinSessions(s) {
+		twins = append(twins, c.replicaValue(ctx, st, key, counter))
+	}
+	if !primary.found {
+		found := false
+		for _, v := range twins {
+			if v.found {
+				found = true
+				issue(primary, ReplicaMissing)
+				break
+			}
+		}
+		// the key expired or was removed on all the replicas
+		return issues, found
+	}
+	for _, v := range twins {
+		var i *ReplicaIssue
+		switch {
+		case v.err != nil:
+			issue(v, ReplicaUnreachable)
+		case !v.found:
+			i = issue(v, ReplicaMissing)
+		case !v.equal(primary):
+			i = issue(v, ReplicaDivergent)
+		}
+		if i != nil && repair {
+			if err := c.repairReplica(ctx, v.session, key, counter, primary); err != nil {
+				i.Err = err.Error()
+			} else {
+				i.Repaired = true
+			}
+		}
+	}
+	return issues, true
+}
+
+// Write the value of the primary node on a replica.
+func (c *Client) repairReplica(ctx context.Context, s *Session, key string, counter bool, primary replicaValue) error {
+	var op nodeOp
+	hash := c.slot(key)
+	if counter {
+		op = func(ctx context.Context, s *Session) (*Response, error) {
+			mdata := &model.OvoCounter{Key: key, Value: primary.value, Hash: hash}
+			return s.WithContext(ctx).Post(createCountersEndpoint(s.Node().Host, s.port), mdata, &model.OvoCounterResponse{}, nil)
+		}
+	} else {
+		op = func(ctx context.Context, s *Session) (*Response, error) {
+			mdata := &model.OvoKVRequest{Key: key, Data: primary.data, Hash: hash}
+			return s.WithContext(ctx).Post(createKeyStorageEndpoint(s.Node().Host, s.port), mdata, &model.OvoResponse{}, nil)
+		}
+	}
+	rs, err := c.classified(op)(ctx, s)
+	if err == nil && rs.status != 200 {
+		err = fmt.Errorf("status %d", rs.status)
+	}
+	return err
+}
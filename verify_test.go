@@ -0,0 +1,98 @@
+package ovoclient
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVerifyReplicas(t *testing.T) {
+	fc := newFakeCluster(t, 3)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	owner := fc.owner("divergent")
+	twin := fc.node(owner.node.Twins[0])
+	owner.store("divergent", []byte(`"new"`))
+	twin.store("divergent", []byte(`"old"`))
+	fc.owner("lagging").store("lagging", []byte(`"value"`))
+	consistent := fc.owner("consistent")
+	consistent.store("consistent", []byte(`"value"`))
+	fc.node(consistent.node.Twins[0]).store("consistent", []byte(`"value"`))
+	// the third node neither owns nor replicates the slot
+	var orphan *fakeNode
+	for _, fn := range fc.nodes {
+		if fn != owner && fn != twin {
+			orphan = fn
+		}
+	}
+	orphan.store("divergent", []byte(`"new"`))
+	report, err := c.VerifyReplicas(context.Background(), VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Keys != 3 || report.Consistent != 1 || len(report.Issues) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for _, issue := range report.Issues {
+		if issue.Key == "divergent" && (issue.Kind != ReplicaDivergent || issue.Node != twin.node.Name) ||
+			issue.Key == "lagging" && issue.Kind != ReplicaMissing || issue.Repaired {
+			t.Errorf("unexpected issue %+v", issue)
+		}
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0].Key != "divergent" || report.Orphans[0].Node != orphan.node.Name {
+		t.Errorf("unexpected orphans %+v", report.Orphans)
+	}
+	// the repair writes the value of the primary on the twins
+	report, err = c.VerifyReplicas(context.Background(), VerifyOptions{Repair: true, Concurrency: 2})
+	if err != nil || report.Repaired != 2 {
+		t.Fatalf("unexpected report %+v, %v", report, err)
+	}
+	if data, _ := twin.value("divergent"); string(data) != `"new"` {
+		t.Errorf("divergent twin not repaired: %s", data)
+	}
+	if report, _ = c.VerifyReplicas(context.Background(), VerifyOptions{}); len(report.Issues) != 0 {
+		t.Errorf("issues after the repair: %+v", report.Issues)
+	}
+}
+
+func TestVerifyCounters(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	if _, err := c.SetCounter("hits", 5, 0, UseWriteConsistency(All)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Increment("hits", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.VerifyReplicas(context.Background(), VerifyOptions{Counters: []string{"hits"}, Repair: true})
+	if err != nil || len(report.Issues) != 1 || !report.Issues[0].Counter || report.Issues[0].Kind != ReplicaDivergent || !report.Issues[0].Repaired {
+		t.Fatalf("unexpected report %+v, %v", report, err)
+	}
+	twin := fc.node(fc.owner("hits").node.Twins[0])
+	if twin.counter("hits") != 6 {
+		t.Errorf("counter not repaired: %d", twin.counter("hits"))
+	}
+}
+
+func TestVerifyUnlistedNode(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	c := NewClientFromConfig(fc.config())
+	defer c.Close()
+	down := fc.nodes[1]
+	key := ownedKeys(fc, down, 1)[0]
+	if err := c.Put(key, "value", 0, UseWriteConsistency(All)); err != nil {
+		t.Fatal(err)
+	}
+	down.setStatus(503)
+	report, err := c.VerifyReplicas(context.Background(), VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unlisted) != 1 || report.Unlisted[0].Node != down.node.Name {
+		t.Fatalf("unexpected unlisted nodes %+v", report.Unlisted)
+	}
+	// the key stored on the twin is still verified
+	if len(report.Issues) != 1 || report.Issues[0].Key != key || report.Issues[0].Kind != ReplicaUnreachable {
+		t.Errorf("unexpected issues %+v", report.Issues)
+	}
+}